@@ -8,6 +8,7 @@ import (
 	"runtime/debug"
 	"syscall"
 
+	"neuron/pkg/config"
 	"neuron/pkg/logger"
 	"neuron/pkg/router"
 	"neuron/pkg/server"
@@ -39,7 +40,7 @@ func main() {
 	setupRoutes(r)
 
 	// Create optimized server
-	srv, ln := server.NewServer(r, r.Logger)
+	srv, ln := server.NewServer(r, r.Logger, config.ServerConfig{})
 
 	// Start server in goroutine
 	go func() {
@@ -3,9 +3,6 @@ package main
 import (
 	"context"
 	"log"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	neuron "neuron/pkg"
@@ -34,15 +31,6 @@ func (l *loggerAdapter) Warn(msg string, fields ...interface{}) {
 }
 
 func main() {
-	// Wait for interrupt signal
-	listenForShutdown := make(chan os.Signal, 1)
-
-	// todo: we probably want to make this a context with signal.NotifyContext()
-	// so we can pass it to neuron.New() or something. That way we can listen
-	// for context.Done() as our cancellation request from a failing service
-	// deep within our app and kill the application in a graceful manner
-	signal.Notify(listenForShutdown, syscall.SIGINT, syscall.SIGTERM)
-
 	// Create a new Neuron engine with default configuration
 	config := neuron.DefaultConfig()
 	config.Host = "0.0.0.0" // Listen on all interfaces
@@ -76,22 +64,11 @@ func main() {
 		})
 	})
 
-	// Start the server
-	if err := app.Start(); err != nil {
-		log.Fatal(err)
-	}
-
-	// this becomes superfluous as we need to use select {} on the interrupt
-	// signal and app.Start() error at the same time. So using the
-	// signal.NotifyContext() feels more appropriate
-	<-listenForShutdown
-
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := app.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	// Run until SIGINT/SIGTERM or a fatal server error, then shut down
+	// gracefully. Cancelling the context from deep within the app has the
+	// same effect as an interrupt.
+	if err := app.Run(context.Background()); err != nil {
+		log.Fatal("Server stopped with error: ", err)
 	}
 
 	log.Println("Server exiting")
@@ -0,0 +1,123 @@
+package neuron
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSaturated is returned when both the in-flight limit and the queue
+	// are full
+	ErrSaturated = errors.New("engine saturated")
+	// ErrQueueTimeout is returned when a queued request waits too long
+	ErrQueueTimeout = errors.New("request queue timeout")
+)
+
+// admission bounds the number of in-flight requests, queueing a limited
+// number of requests for a limited time when all slots are taken
+type admission struct {
+	slots    chan struct{}
+	maxQueue int64
+	maxWait  time.Duration
+	metrics  *MetricsCollector
+}
+
+func newAdmission(concurrency, queueSize int, maxWait time.Duration, metrics *MetricsCollector) *admission {
+	return &admission{
+		slots:    make(chan struct{}, concurrency),
+		maxQueue: int64(queueSize),
+		maxWait:  maxWait,
+		metrics:  metrics,
+	}
+}
+
+// acquire takes an in-flight slot, waiting in the queue if needed for up to
+// maxWait, or until ctx is done when maxWait is zero
+func (a *admission) acquire(ctx context.Context) error {
+	// Fast path: a slot is free
+	select {
+	case a.slots <- struct{}{}:
+		a.metrics.admitted.Add(1)
+		return nil
+	default:
+	}
+
+	if a.metrics.queued.Add(1) > a.maxQueue {
+		a.metrics.queued.Add(-1)
+		a.metrics.rejected.Add(1)
+		return ErrSaturated
+	}
+	defer a.metrics.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if a.maxWait > 0 {
+		timer := time.NewTimer(a.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		a.metrics.admitted.Add(1)
+		return nil
+	case <-timeout:
+		a.metrics.queueTimeouts.Add(1)
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees an in-flight slot
+func (a *admission) release() {
+	<-a.slots
+}
+
+// reject answers a request that was not admitted
+func (e *Engine) reject(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client went away while queued
+		return
+	}
+
+	retryAfter := e.config.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+}
+
+func isHealthPath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
+
+// EngineMetrics is a snapshot of the engine's request and worker metrics
+type EngineMetrics struct {
+	InFlightRequests int64       `json:"inFlightRequests"`
+	QueuedRequests   int64       `json:"queuedRequests"`
+	AdmittedRequests uint64      `json:"admittedRequests"`
+	RejectedRequests uint64      `json:"rejectedRequests"`
+	QueueTimeouts    uint64      `json:"queueTimeouts"`
+	Workers          WorkerStats `json:"workers"`
+}
+
+// Metrics returns a snapshot of the engine's metrics, including the
+// admission queue depth
+func (e *Engine) Metrics() EngineMetrics {
+	m := EngineMetrics{
+		InFlightRequests: e.inFlight.Load(),
+		QueuedRequests:   e.metrics.queued.Load(),
+		AdmittedRequests: e.metrics.admitted.Load(),
+		RejectedRequests: e.metrics.rejected.Load(),
+		QueueTimeouts:    e.metrics.queueTimeouts.Load(),
+	}
+	if e.pool != nil {
+		m.Workers = e.pool.Stats()
+	}
+	return m
+}
@@ -37,12 +37,82 @@ type TaggedCache interface {
 // Options for cache configuration
 type Options struct {
 	Prefix          string
-	DefaultTTL      time.Duration
 	MaxEntries      int
 	MaxMemory       int64
 	Compression     bool
 	SerializeFunc   func(interface{}) ([]byte, error)
 	DeserializeFunc func([]byte) (interface{}, error)
+
+	// DefaultTTL applies to writes made with a zero ttl; when it is zero
+	// too, such values are kept until they are deleted or evicted
+	DefaultTTL time.Duration
+
+	// Eviction selects the MemoryCache eviction policy: EvictionLRU (the
+	// default), EvictionLFU or EvictionARC
+	Eviction string
+	// OnEvict is called with each entry evicted to make room. It runs with
+	// the cache locked and must not call back into the cache.
+	OnEvict func(key string, value interface{})
+	// Shards is the number of lock-striped MemoryCache partitions, rounded
+	// down to a power of two. It defaults to four per CPU, reduced so each
+	// shard keeps at least 64 entries or 1MiB of a bounded cache; limits
+	// and eviction apply per shard.
+	Shards int
+
+	// StaleWhileRevalidate keeps values written by Remember for this long
+	// past their TTL. Remember serves such a stale value while one
+	// background refresh replaces it, and Get keeps returning it.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError keeps values written by Remember for this long past
+	// their TTL, and Remember serves them when refreshing fails
+	StaleIfError time.Duration
+	// EarlyExpiration enables probabilistic early refresh in Remember: a
+	// hit may refresh a value in the background before its TTL, more
+	// likely as expiry nears and the slower the loader was. It scales that
+	// probability; 1 is a sensible value and 0 disables it.
+	EarlyExpiration float64
+
+	// Codec encodes values for caches that store bytes; defaults to
+	// JSONCodec. SerializeFunc and DeserializeFunc take precedence.
+	Codec Codec
+	// CompressionAlgorithm is used when Compression is on: gzip (the
+	// default), snappy or zstd. Only encoded values of at least
+	// CompressionThreshold bytes, default 1KiB, are compressed.
+	CompressionAlgorithm string
+	CompressionThreshold int
+}
+
+func (o Options) codec() Codec {
+	if o.Codec != nil {
+		return o.Codec
+	}
+	return JSONCodec
+}
+
+// Stats is a snapshot of a cache's counters
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Sets        uint64
+	Errors      uint64
+	Evictions   uint64
+	Expirations uint64
+	Entries     int
+	Memory      int64 // estimated size of the entries in bytes
+}
+
+// HitRatio returns the share of lookups that were hits, or 0 before any
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// StatsProvider is implemented by caches that report Stats. Views created
+// by WithPrefix and Tags share their parent's counters.
+type StatsProvider interface {
+	Stats() Stats
 }
 
 // CacheError represents cache-specific errors
@@ -55,14 +125,3 @@ type CacheError struct {
 func (e *CacheError) Error() string {
 	return fmt.Sprintf("cache %s failed for key '%s': %v", e.Op, e.Key, e.Err)
 }
-
-// Factory for creating cache instances
-type Factory struct {
-	providers map[string]func(Options) (Cache, error)
-}
-
-func NewFactory() *Factory {
-	return &Factory{
-		providers: make(map[string]func(Options) (Cache, error)),
-	}
-}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes values for caches that store bytes, such as RedisCache.
+// Values written by Increment are stored as decimal integers, which only
+// JSONCodec reads back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec is the default codec. Get returns objects as
+	// map[string]interface{} and numbers as float64; use GetAs for
+	// structs.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes with encoding/gob. Gob values can only be read
+	// with GetAs and RememberAs, into the type that was stored.
+	GobCodec Codec = gobCodec{}
+	// MsgpackCodec encodes with MessagePack, which is more compact than
+	// JSON
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// Compression algorithms for Options.CompressionAlgorithm
+const (
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+// defaultCompressionThreshold is the smallest encoded value compressed
+// when Options.CompressionThreshold is unset
+const defaultCompressionThreshold = 1024
+
+// compressedMagic starts every compressed value, followed by a byte naming
+// the algorithm. No JSON, gob or MessagePack encoding of a single value
+// starts with it.
+var compressedMagic = []byte{0x00, 'Z'}
+
+var algorithmIDs = map[string]byte{
+	CompressionGzip:   'g',
+	CompressionSnappy: 's',
+	CompressionZstd:   'z',
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// compress compresses data when compression is on and data is at least the
+// threshold, prefixing it with a header naming the algorithm
+func compress(data []byte, opts Options) ([]byte, error) {
+	threshold := opts.CompressionThreshold
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+	if !opts.Compression || len(data) < threshold {
+		return data, nil
+	}
+
+	algorithm := opts.CompressionAlgorithm
+	if algorithm == "" {
+		algorithm = CompressionGzip
+	}
+	id, ok := algorithmIDs[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+	}
+	out := append(append([]byte(nil), compressedMagic...), id)
+
+	switch algorithm {
+	case CompressionSnappy:
+		return append(out, snappy.Encode(nil, data)...), nil
+	case CompressionZstd:
+		encoder, _ := zstdCodecs()
+		return encoder.EncodeAll(data, out), nil
+	}
+
+	buf := bytes.NewBuffer(out)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress reverses compress. Data without the header is returned as is,
+// so values written before compression was turned on stay readable.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) <= len(compressedMagic) || !bytes.HasPrefix(data, compressedMagic) {
+		return data, nil
+	}
+
+	id, body := data[len(compressedMagic)], data[len(compressedMagic)+1:]
+	switch id {
+	case algorithmIDs[CompressionGzip]:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case algorithmIDs[CompressionSnappy]:
+		return snappy.Decode(nil, body)
+	case algorithmIDs[CompressionZstd]:
+		_, decoder := zstdCodecs()
+		return decoder.DecodeAll(body, nil)
+	}
+	return nil, fmt.Errorf("unknown compression header %q", id)
+}
+
+// typedCache is implemented by caches storing encoded values, so GetAs and
+// RememberAs can decode into the caller's type rather than interface{}.
+// target returns a pointer to a new value of that type.
+type typedCache interface {
+	getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error)
+	rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error)
+}
+
+var (
+	_ typedCache = (*RedisCache)(nil)
+	_ typedCache = (*RedisTaggedCache)(nil)
+	_ typedCache = (*TieredCache)(nil)
+	_ typedCache = (*TieredTaggedCache)(nil)
+)
+
+// GetAs returns the value of key as a T. Caches that store encoded values
+// decode it straight into a T; others return an error if the stored value
+// is not a T.
+func GetAs[T any](ctx context.Context, c Cache, key string) (T, error) {
+	var value interface{}
+	var err error
+	if tc, ok := c.(typedCache); ok {
+		value, err = tc.getTyped(ctx, key, newTarget[T])
+	} else {
+		value, err = c.Get(ctx, key)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return as[T](key, value)
+}
+
+// RememberAs is Remember for values of type T, with the same stampede
+// protection
+func RememberAs[T any](ctx context.Context, c Cache, key string, ttl time.Duration, callback func() (T, error)) (T, error) {
+	load := func() (interface{}, error) {
+		return callback()
+	}
+
+	var value interface{}
+	var err error
+	if tc, ok := c.(typedCache); ok {
+		value, err = tc.rememberTyped(ctx, key, ttl, load, newTarget[T])
+	} else {
+		value, err = c.Remember(ctx, key, ttl, load)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return as[T](key, value)
+}
+
+// fits reports whether value has the type target points to
+func fits(value interface{}, target func() interface{}) bool {
+	if target == nil {
+		return true
+	}
+	want := reflect.TypeOf(target()).Elem()
+	if value == nil {
+		return want.Kind() == reflect.Interface
+	}
+	return reflect.TypeOf(value).AssignableTo(want)
+}
+
+func newTarget[T any]() interface{} {
+	return new(T)
+}
+
+func as[T any](key string, value interface{}) (T, error) {
+	typed, ok := value.(T)
+	if !ok {
+		return typed, fmt.Errorf("cached value for %s is %T, not %T", key, value, typed)
+	}
+	return typed, nil
+}
+
+// decodeInto decodes data into a new target value, or into interface{}
+// without a target
+func decodeInto(data []byte, target func() interface{}, decode func([]byte, interface{}) error) (interface{}, error) {
+	if target == nil {
+		var value interface{}
+		err := decode(data, &value)
+		return value, err
+	}
+
+	ptr := target()
+	if err := decode(data, ptr); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
+
+// assign stores value in the pointer target, as DeserializeFunc results
+// must be
+func assign(target interface{}, value interface{}) error {
+	dst := reflect.ValueOf(target).Elem()
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	src := reflect.ValueOf(value)
+	if !src.Type().AssignableTo(dst.Type()) {
+		return errors.New("deserialized " + src.Type().String() + " is not assignable to " + dst.Type().String())
+	}
+	dst.Set(src)
+	return nil
+}
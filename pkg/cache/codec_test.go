@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+type profile struct {
+	Name  string
+	Tags  []string
+	Score int
+}
+
+func TestRedisCache_Codecs(t *testing.T) {
+	long := profile{Name: strings.Repeat("ada ", 500), Tags: []string{"admin"}, Score: 42}
+	short := profile{Name: "grace", Score: 7}
+
+	tests := []struct {
+		name      string
+		codec     Codec
+		algorithm string
+	}{
+		{"json", JSONCodec, ""},
+		{"gob", GobCodec, ""},
+		{"msgpack", MsgpackCodec, ""},
+		{"json+gzip", JSONCodec, CompressionGzip},
+		{"gob+snappy", GobCodec, CompressionSnappy},
+		{"msgpack+zstd", MsgpackCodec, CompressionZstd},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			c, err := NewRedisCache(Options{
+				Codec:                tt.codec,
+				Compression:          tt.algorithm != "",
+				CompressionAlgorithm: tt.algorithm,
+			}, &redis.Options{Addr: mr.Addr()})
+			if err != nil {
+				t.Fatalf("NewRedisCache() error = %v", err)
+			}
+			ctx := context.Background()
+
+			for key, want := range map[string]profile{"long": long, "short": short} {
+				if err := c.Set(ctx, key, want, time.Minute); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+				got, err := GetAs[profile](ctx, c, key)
+				if err != nil || got.Name != want.Name || got.Score != want.Score {
+					t.Errorf("GetAs(%s) = %+v, %v", key, got, err)
+				}
+			}
+
+			raw, _ := mr.Get("long")
+			if compressed := bytes.HasPrefix([]byte(raw), compressedMagic); compressed != (tt.algorithm != "") {
+				t.Errorf("long value compressed = %v, want %v", compressed, tt.algorithm != "")
+			}
+			if raw, _ := mr.Get("short"); bytes.HasPrefix([]byte(raw), compressedMagic) {
+				t.Error("value below the threshold was compressed")
+			}
+
+			calls := 0
+			for i := 0; i < 2; i++ {
+				got, err := RememberAs(ctx, c, "remembered", time.Minute, func() (profile, error) {
+					calls++
+					return short, nil
+				})
+				if err != nil || got.Name != "grace" {
+					t.Errorf("RememberAs() = %+v, %v", got, err)
+				}
+			}
+			if calls != 1 {
+				t.Errorf("RememberAs() called the loader %d times, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestGetAs_Memory(t *testing.T) {
+	c := NewMemoryCache(Options{})
+	ctx := context.Background()
+	c.Set(ctx, "user", profile{Name: "ada"}, 0)
+
+	if got, err := GetAs[profile](ctx, c, "user"); err != nil || got.Name != "ada" {
+		t.Errorf("GetAs() = %+v, %v", got, err)
+	}
+	if _, err := GetAs[string](ctx, c, "user"); err == nil {
+		t.Error("GetAs() of the wrong type error = nil")
+	}
+}
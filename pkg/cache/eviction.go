@@ -0,0 +1,253 @@
+package cache
+
+import "container/list"
+
+// Eviction policies for MemoryCache
+const (
+	// EvictionLRU evicts the least recently used entry (the default)
+	EvictionLRU = "lru"
+	// EvictionLFU evicts the least frequently used entry, and the least
+	// recently used among equally frequent ones
+	EvictionLFU = "lfu"
+	// EvictionARC adapts between recency and frequency (Adaptive
+	// Replacement Cache), resisting scans that would flush an LRU cache
+	EvictionARC = "arc"
+)
+
+// policy tracks resident keys and picks eviction victims. Every method is
+// O(1). Callers serialize access.
+type policy interface {
+	// add records a newly inserted key
+	add(key string)
+	// access records a hit on a resident key
+	access(key string)
+	// remove forgets a key that was deleted or expired
+	remove(key string)
+	// victim removes and returns the key to evict
+	victim() (string, bool)
+}
+
+// newPolicy creates the named policy; unknown names fall back to LRU
+func newPolicy(name string, capacity int) policy {
+	switch name {
+	case EvictionLFU:
+		return newLFU()
+	case EvictionARC:
+		return newARC(capacity)
+	default:
+		return newLRU()
+	}
+}
+
+// lru keeps keys in a list ordered from most to least recently used
+type lru struct {
+	order *list.List
+	index map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New(), index: make(map[string]*list.Element)}
+}
+
+func (p *lru) add(key string) {
+	if e, ok := p.index[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.index[key] = p.order.PushFront(key)
+}
+
+func (p *lru) access(key string) {
+	if e, ok := p.index[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if e, ok := p.index[key]; ok {
+		p.order.Remove(e)
+		delete(p.index, key)
+	}
+}
+
+func (p *lru) victim() (string, bool) {
+	e := p.order.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	p.order.Remove(e)
+	delete(p.index, key)
+	return key, true
+}
+
+// lfu keeps an ascending list of frequency buckets, each holding its keys
+// from most to least recently used
+type lfu struct {
+	buckets *list.List
+	index   map[string]*lfuEntry
+}
+
+type lfuBucket struct {
+	freq int
+	keys *list.List
+}
+
+type lfuEntry struct {
+	bucket *list.Element
+	elem   *list.Element
+}
+
+func newLFU() *lfu {
+	return &lfu{buckets: list.New(), index: make(map[string]*lfuEntry)}
+}
+
+func (p *lfu) add(key string) {
+	if _, ok := p.index[key]; ok {
+		p.access(key)
+		return
+	}
+
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = p.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	p.index[key] = &lfuEntry{bucket: front, elem: front.Value.(*lfuBucket).keys.PushFront(key)}
+}
+
+func (p *lfu) access(key string) {
+	entry, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	current := entry.bucket.Value.(*lfuBucket)
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != current.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{freq: current.freq + 1, keys: list.New()}, entry.bucket)
+	}
+
+	p.unlink(entry)
+	entry.bucket = next
+	entry.elem = next.Value.(*lfuBucket).keys.PushFront(key)
+}
+
+func (p *lfu) remove(key string) {
+	if entry, ok := p.index[key]; ok {
+		p.unlink(entry)
+		delete(p.index, key)
+	}
+}
+
+func (p *lfu) victim() (string, bool) {
+	front := p.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	key := front.Value.(*lfuBucket).keys.Back().Value.(string)
+	p.remove(key)
+	return key, true
+}
+
+// unlink removes the entry from its bucket, dropping the bucket if empty
+func (p *lfu) unlink(entry *lfuEntry) {
+	bucket := entry.bucket.Value.(*lfuBucket)
+	bucket.keys.Remove(entry.elem)
+	if bucket.keys.Len() == 0 {
+		p.buckets.Remove(entry.bucket)
+	}
+}
+
+// arc implements Adaptive Replacement Cache. Resident keys are split into
+// t1 (seen once recently) and t2 (seen at least twice); b1 and b2 remember
+// keys recently evicted from each. A hit in a ghost list shifts the target
+// size p of t1 towards the list that would have kept the key.
+type arc struct {
+	capacity       int
+	p              int
+	t1, t2, b1, b2 *list.List
+	index          map[string]*arcEntry
+}
+
+type arcEntry struct {
+	list *list.List
+	elem *list.Element
+}
+
+func newARC(capacity int) *arc {
+	return &arc{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		index:    make(map[string]*arcEntry),
+	}
+}
+
+func (p *arc) add(key string) {
+	entry, ok := p.index[key]
+	switch {
+	case ok && entry.list == p.b1:
+		p.p = min(p.limit(), p.p+max(p.b2.Len()/p.b1.Len(), 1))
+		p.move(key, entry, p.t2)
+	case ok && entry.list == p.b2:
+		p.p = max(0, p.p-max(p.b1.Len()/p.b2.Len(), 1))
+		p.move(key, entry, p.t2)
+	case ok:
+		p.move(key, entry, p.t2)
+	default:
+		p.index[key] = &arcEntry{list: p.t1, elem: p.t1.PushFront(key)}
+	}
+}
+
+func (p *arc) access(key string) {
+	if entry, ok := p.index[key]; ok && (entry.list == p.t1 || entry.list == p.t2) {
+		p.move(key, entry, p.t2)
+	}
+}
+
+func (p *arc) remove(key string) {
+	if entry, ok := p.index[key]; ok {
+		entry.list.Remove(entry.elem)
+		delete(p.index, key)
+	}
+}
+
+func (p *arc) victim() (string, bool) {
+	from, ghost := p.t2, p.b2
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0) {
+		from, ghost = p.t1, p.b1
+	}
+
+	e := from.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	p.move(key, p.index[key], ghost)
+
+	// Ghost lists remember at most as many keys as the cache holds
+	limit := p.limit()
+	for _, g := range []*list.List{p.b1, p.b2} {
+		for g.Len() > limit {
+			p.remove(g.Back().Value.(string))
+		}
+	}
+	return key, true
+}
+
+// limit is the entry capacity, or the resident count for caches bounded
+// only by memory
+func (p *arc) limit() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return max(p.t1.Len()+p.t2.Len(), 1)
+}
+
+func (p *arc) move(key string, entry *arcEntry, to *list.List) {
+	entry.list.Remove(entry.elem)
+	entry.list = to
+	entry.elem = to.PushFront(key)
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"neuron/pkg/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Built-in drivers, selected by config.CacheConfig.Driver
+const (
+	DriverMemory        = "memory"
+	DriverRedis         = "redis"
+	DriverRedisCluster  = "redis-cluster"
+	DriverRedisSentinel = "redis-sentinel"
+	DriverNoop          = "noop"
+)
+
+// Provider builds a cache from its configuration. opts holds the settings
+// common to every driver, already read from cfg.
+type Provider func(cfg config.CacheConfig, opts Options) (Cache, error)
+
+// Factory for creating cache instances
+type Factory struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewFactory creates a factory with the built-in drivers registered
+func NewFactory() *Factory {
+	f := &Factory{
+		providers: make(map[string]Provider),
+	}
+	f.Register(DriverMemory, newMemoryProvider)
+	f.Register(DriverRedis, newRedisProvider)
+	f.Register(DriverRedisCluster, newRedisClusterProvider)
+	f.Register(DriverRedisSentinel, newRedisSentinelProvider)
+	f.Register(DriverNoop, func(config.CacheConfig, Options) (Cache, error) {
+		return NoopCache{}, nil
+	})
+	return f
+}
+
+// Register adds a driver, replacing any already registered under the name
+func (f *Factory) Register(driver string, provider Provider) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.providers[driver] = provider
+}
+
+// Create builds the cache for cfg.Driver, which defaults to memory
+func (f *Factory) Create(cfg config.CacheConfig) (Cache, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = DriverMemory
+	}
+
+	f.mu.RLock()
+	provider, ok := f.providers[driver]
+	f.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cache driver %q is not registered", driver)
+	}
+
+	c, err := provider(cfg, Options{
+		Prefix:     cfg.Prefix,
+		DefaultTTL: time.Duration(cfg.DefaultTTL) * time.Second,
+		MaxEntries: cfg.MaxEntries,
+		MaxMemory:  cfg.MaxMemory,
+		Eviction:   cfg.Eviction,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s cache: %w", driver, err)
+	}
+	return c, nil
+}
+
+func newMemoryProvider(cfg config.CacheConfig, opts Options) (Cache, error) {
+	return NewMemoryCache(opts), nil
+}
+
+func newRedisProvider(cfg config.CacheConfig, opts Options) (Cache, error) {
+	host, port := cfg.Host, cfg.Port
+	if host == "" {
+		host = "localhost"
+	}
+	if port == 0 {
+		port = 6379
+	}
+
+	return NewRedisCache(opts, &redis.Options{
+		Addr:       fmt.Sprintf("%s:%d", host, port),
+		Password:   cfg.Password,
+		DB:         cfg.DB,
+		MaxRetries: cfg.MaxRetries,
+		PoolSize:   cfg.PoolSize,
+	})
+}
+
+func newRedisClusterProvider(cfg config.CacheConfig, opts Options) (Cache, error) {
+	addrs := cfg.Addrs
+	if len(addrs) == 0 && cfg.Host != "" {
+		port := cfg.Port
+		if port == 0 {
+			port = 6379
+		}
+		addrs = []string{fmt.Sprintf("%s:%d", cfg.Host, port)}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no cluster addresses configured")
+	}
+
+	return newUniversal(opts, redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:      addrs,
+		Password:   cfg.Password,
+		MaxRetries: cfg.MaxRetries,
+		PoolSize:   cfg.PoolSize,
+	}))
+}
+
+func newRedisSentinelProvider(cfg config.CacheConfig, opts Options) (Cache, error) {
+	if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+		return nil, fmt.Errorf("sentinel needs a master name and sentinel addresses")
+	}
+
+	return newUniversal(opts, redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:    cfg.MasterName,
+		SentinelAddrs: cfg.Addrs,
+		Password:      cfg.Password,
+		DB:            cfg.DB,
+		MaxRetries:    cfg.MaxRetries,
+		PoolSize:      cfg.PoolSize,
+	}))
+}
+
+// newUniversal creates a RedisCache on client, closing it on failure
+func newUniversal(opts Options, client redis.UniversalClient) (Cache, error) {
+	c, err := NewRedisCacheWithClient(opts, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return c, nil
+}
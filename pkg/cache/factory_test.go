@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"neuron/pkg/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestFactory_Create(t *testing.T) {
+	mr := miniredis.RunT(t)
+	host, port, _ := strings.Cut(mr.Addr(), ":")
+	portNum, _ := strconv.Atoi(port)
+
+	tests := []struct {
+		name    string
+		cfg     config.CacheConfig
+		want    string
+		wantErr bool
+	}{
+		{"default", config.CacheConfig{}, "*cache.MemoryCache", false},
+		{"memory", config.CacheConfig{Driver: DriverMemory, MaxEntries: 10}, "*cache.MemoryCache", false},
+		{"noop", config.CacheConfig{Driver: DriverNoop}, "cache.NoopCache", false},
+		{"redis", config.CacheConfig{Driver: DriverRedis, Host: host, Port: portNum, Prefix: "app"}, "*cache.RedisCache", false},
+		{"redis cluster", config.CacheConfig{Driver: DriverRedisCluster, Addrs: []string{mr.Addr()}, Prefix: "app"}, "*cache.RedisCache", false},
+		{"sentinel without master", config.CacheConfig{Driver: DriverRedisSentinel, Addrs: []string{mr.Addr()}}, "", true},
+		{"unknown", config.CacheConfig{Driver: "memcached"}, "", true},
+	}
+
+	f := NewFactory()
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := f.Create(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := fmt.Sprintf("%T", c); got != tt.want {
+				t.Errorf("Create() = %s, want %s", got, tt.want)
+			}
+
+			ctx := context.Background()
+			c.Set(ctx, "k1", "v", 0)
+			c.Set(ctx, "k2", "v", 0)
+			c.DeleteMany(ctx, []string{"k1", "k2"})
+			if err := c.Clear(ctx); err != nil {
+				t.Errorf("Clear() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFactory_Register(t *testing.T) {
+	f := NewFactory()
+	f.Register("custom", func(cfg config.CacheConfig, opts Options) (Cache, error) {
+		if opts.Prefix != "app" {
+			t.Errorf("provider got prefix %q, want app", opts.Prefix)
+		}
+		return NoopCache{}, nil
+	})
+
+	if _, err := f.Create(config.CacheConfig{Driver: "custom", Prefix: "app"}); err != nil {
+		t.Errorf("Create() error = %v", err)
+	}
+}
+
+func TestFactory_DefaultTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	host, port, _ := strings.Cut(mr.Addr(), ":")
+	portNum, _ := strconv.Atoi(port)
+	ctx := context.Background()
+
+	f := NewFactory()
+	c, err := f.Create(config.CacheConfig{Driver: DriverRedis, Host: host, Port: portNum, Prefix: "app", DefaultTTL: 60})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	c.Set(ctx, "plain", "v", 0)
+	c.SetMany(ctx, map[string]interface{}{"many": "v"}, 0)
+	c.Tags("t").Set(ctx, "tagged", "v", 0)
+	c.Set(ctx, "explicit", "v", time.Hour)
+	for key, want := range map[string]time.Duration{"app:plain": time.Minute, "app:many": time.Minute, "app:tagged": time.Minute, "app:explicit": time.Hour} {
+		if got := mr.TTL(key); got != want {
+			t.Errorf("TTL(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	m := NewMemoryCache(Options{DefaultTTL: 20 * time.Millisecond})
+	m.Set(ctx, "plain", "v", 0)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.Get(ctx, "plain"); err == nil {
+		t.Error("memory value written with a zero ttl outlived DefaultTTL")
+	}
+}
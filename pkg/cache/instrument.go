@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"neuron/pkg/metrics"
+)
+
+var (
+	_ TaggedCache = (*InstrumentedTaggedCache)(nil)
+	_ typedCache  = (*InstrumentedCache)(nil)
+)
+
+// Logger receives InstrumentedCache's debug entries, with fields given as
+// alternating keys and values
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+}
+
+// InstrumentOptions configures an InstrumentedCache
+type InstrumentOptions struct {
+	// Name identifies the cache in log entries
+	Name string
+	// Metrics receives the latency and outcome of every operation; nil
+	// disables metrics
+	Metrics *metrics.CacheMetrics
+	// Logger receives a debug entry per operation; nil disables logging
+	Logger Logger
+}
+
+// InstrumentedCache wraps a Cache to report the latency of each operation
+// and the hits and misses of lookups to the metrics subsystem and a debug
+// log. Misses are not counted as errors.
+type InstrumentedCache struct {
+	cache   Cache
+	options InstrumentOptions
+}
+
+// NewInstrumentedCache wraps c. Views created by WithPrefix and Tags are
+// instrumented too.
+func NewInstrumentedCache(c Cache, opts InstrumentOptions) *InstrumentedCache {
+	return &InstrumentedCache{cache: c, options: opts}
+}
+
+func (c *InstrumentedCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return c.getTyped(ctx, key, nil)
+}
+
+func (c *InstrumentedCache) getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error) {
+	start := time.Now()
+	var value interface{}
+	var err error
+	if tc, ok := c.cache.(typedCache); ok && target != nil {
+		value, err = tc.getTyped(ctx, key, target)
+	} else {
+		value, err = c.cache.Get(ctx, key)
+	}
+
+	switch {
+	case err == nil:
+		c.observe("get", []string{key}, start, 1, 0, nil)
+	case missed(err):
+		c.observe("get", []string{key}, start, 0, 1, nil)
+	default:
+		c.observe("get", []string{key}, start, 0, 0, err)
+	}
+	return value, err
+}
+
+func (c *InstrumentedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := c.cache.Set(ctx, key, value, ttl)
+	c.observe("set", []string{key}, start, 0, 0, err)
+	return err
+}
+
+func (c *InstrumentedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.cache.Delete(ctx, key)
+	c.observe("delete", []string{key}, start, 0, 0, err)
+	return err
+}
+
+func (c *InstrumentedCache) Clear(ctx context.Context) error {
+	start := time.Now()
+	err := c.cache.Clear(ctx)
+	c.observe("clear", nil, start, 0, 0, err)
+	return err
+}
+
+func (c *InstrumentedCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	start := time.Now()
+	values, err := c.cache.GetMany(ctx, keys)
+	if err != nil {
+		c.observe("get_many", keys, start, 0, 0, err)
+	} else {
+		c.observe("get_many", keys, start, len(values), len(keys)-len(values), nil)
+	}
+	return values, err
+}
+
+func (c *InstrumentedCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetMany(ctx, items, ttl)
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	c.observe("set_many", keys, start, 0, 0, err)
+	return err
+}
+
+func (c *InstrumentedCache) DeleteMany(ctx context.Context, keys []string) error {
+	start := time.Now()
+	err := c.cache.DeleteMany(ctx, keys)
+	c.observe("delete_many", keys, start, 0, 0, err)
+	return err
+}
+
+// Remember counts a miss when the caller waited on a load, its own or
+// another caller's, and a hit when the value came from the cache, even if a
+// background refresh ran callback. For caches that do not report this, such
+// as NoopCache, a call that ran callback counts as a miss.
+func (c *InstrumentedCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
+	return c.rememberTyped(ctx, key, ttl, callback, nil)
+}
+
+func (c *InstrumentedCache) rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	start := time.Now()
+	o := &outcome{}
+	ctx = context.WithValue(ctx, outcomeKey{}, o)
+	var loaded atomic.Bool
+	load := func() (interface{}, error) {
+		loaded.Store(true)
+		return callback()
+	}
+
+	var value interface{}
+	var err error
+	if tc, ok := c.cache.(typedCache); ok && target != nil {
+		value, err = tc.rememberTyped(ctx, key, ttl, load, target)
+	} else {
+		value, err = c.cache.Remember(ctx, key, ttl, load)
+	}
+
+	switch {
+	case err != nil:
+		c.observe("remember", []string{key}, start, 0, 0, err)
+	case o.waited.Load() || !o.handled.Load() && loaded.Load():
+		c.observe("remember", []string{key}, start, 0, 1, nil)
+	default:
+		c.observe("remember", []string{key}, start, 1, 0, nil)
+	}
+	return value, err
+}
+
+func (c *InstrumentedCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
+	start := time.Now()
+	result, err := c.cache.Increment(ctx, key, value)
+	c.observe("increment", []string{key}, start, 0, 0, err)
+	return result, err
+}
+
+func (c *InstrumentedCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	start := time.Now()
+	result, err := c.cache.Decrement(ctx, key, value)
+	c.observe("decrement", []string{key}, start, 0, 0, err)
+	return result, err
+}
+
+func (c *InstrumentedCache) Tags(tags ...string) TaggedCache {
+	tagged := c.cache.Tags(tags...)
+	return &InstrumentedTaggedCache{
+		InstrumentedCache: InstrumentedCache{cache: tagged, options: c.options},
+		tagged:            tagged,
+	}
+}
+
+func (c *InstrumentedCache) WithPrefix(prefix string) Cache {
+	return NewInstrumentedCache(c.cache.WithPrefix(prefix), c.options)
+}
+
+// Stats returns the wrapped cache's Stats, if it reports any
+func (c *InstrumentedCache) Stats() Stats {
+	if provider, ok := c.cache.(StatsProvider); ok {
+		return provider.Stats()
+	}
+	return Stats{}
+}
+
+// Ping pings the wrapped cache, if it is backed by a server
+func (c *InstrumentedCache) Ping(ctx context.Context) error {
+	if pinger, ok := c.cache.(interface{ Ping(context.Context) error }); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped cache, if it holds connections
+func (c *InstrumentedCache) Close() error {
+	if closer, ok := c.cache.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// observe reports an operation on keys that started at start
+func (c *InstrumentedCache) observe(op string, keys []string, start time.Time, hits, misses int, err error) {
+	elapsed := time.Since(start)
+	if m := c.options.Metrics; m != nil {
+		m.TrackOperation(op, elapsed, err)
+		if hits+misses > 0 {
+			m.TrackLookups(hits, misses)
+		}
+	}
+
+	if c.options.Logger == nil {
+		return
+	}
+	fields := []interface{}{"cache", c.options.Name, "op", op, "duration", elapsed.String()}
+	if len(keys) == 1 {
+		fields = append(fields, "key", keys[0])
+	} else if len(keys) > 1 {
+		fields = append(fields, "keys", len(keys))
+	}
+	if hits+misses > 0 {
+		fields = append(fields, "hits", hits, "misses", misses)
+	}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+	c.options.Logger.Debug("cache operation", fields...)
+}
+
+// missed reports whether err means a lookup found nothing
+func missed(err error) bool {
+	return errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrKeyExpired)
+}
+
+// InstrumentedTaggedCache is the instrumented view returned by
+// InstrumentedCache.Tags
+type InstrumentedTaggedCache struct {
+	InstrumentedCache
+	tagged TaggedCache
+}
+
+func (t *InstrumentedTaggedCache) Flush(ctx context.Context) error {
+	start := time.Now()
+	err := t.tagged.Flush(ctx)
+	t.observe("flush", nil, start, 0, 0, err)
+	return err
+}
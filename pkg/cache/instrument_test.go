@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"neuron/pkg/metrics"
+)
+
+func TestStats(t *testing.T) {
+	redisCache, _ := newTestRedisCache(t, "app")
+	backends := map[string]Cache{
+		"memory": NewMemoryCache(Options{}),
+		"redis":  redisCache,
+	}
+
+	for name, c := range backends {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c.Set(ctx, "a", "1", time.Minute)
+			c.Get(ctx, "a")
+			c.Get(ctx, "missing")
+			c.GetMany(ctx, []string{"a", "missing"})
+			// Views count towards their parent
+			c.WithPrefix("view").Set(ctx, "b", "2", time.Minute)
+
+			stats := c.(StatsProvider).Stats()
+			if stats.Hits != 2 || stats.Misses != 2 || stats.Sets != 2 || stats.Entries != 2 {
+				t.Errorf("Stats() = %+v, want 2 hits, 2 misses, 2 sets and 2 entries", stats)
+			}
+			if ratio := stats.HitRatio(); ratio != 0.5 {
+				t.Errorf("HitRatio() = %v, want 0.5", ratio)
+			}
+		})
+	}
+}
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...interface{}) {
+	l.entries = append(l.entries, fmt.Sprint(append([]interface{}{msg}, fields...)...))
+}
+
+func TestInstrumentedCache(t *testing.T) {
+	m := &metrics.CacheMetrics{}
+	logger := &recordingLogger{}
+	c := NewInstrumentedCache(NewMemoryCache(Options{}), InstrumentOptions{Name: "test", Metrics: m, Logger: logger})
+	ctx := context.Background()
+
+	c.Set(ctx, "a", int64(1), 0)
+	c.Get(ctx, "a")
+	c.Get(ctx, "missing")
+	c.Remember(ctx, "b", time.Minute, func() (interface{}, error) { return "loaded", nil })
+	c.Remember(ctx, "b", time.Minute, func() (interface{}, error) { return "loaded", nil })
+	c.Tags("t").Increment(ctx, "missing", 1)
+	if _, err := GetAs[int64](ctx, c, "a"); err != nil {
+		t.Errorf("GetAs() error = %v", err)
+	}
+
+	if m.Hits != 3 || m.Misses != 2 || m.HitRatio() != 0.6 {
+		t.Errorf("hits = %d, misses = %d, ratio = %v, want 3, 2 and 0.6", m.Hits, m.Misses, m.HitRatio())
+	}
+
+	ops := m.Operations()
+	for name, want := range map[string]uint64{"set": 1, "get": 3, "remember": 2, "increment": 1} {
+		if ops[name].Count != want {
+			t.Errorf("%s count = %d, want %d", name, ops[name].Count, want)
+		}
+	}
+	// A miss is not an error, but incrementing a missing key is
+	if ops["get"].Errors != 0 || ops["increment"].Errors != 1 {
+		t.Errorf("operations = %+v, want only the increment to fail", ops)
+	}
+	if len(logger.entries) != 7 {
+		t.Errorf("logged %d entries, want 7", len(logger.entries))
+	}
+	if stats := c.Stats(); stats.Sets != 2 {
+		t.Errorf("Stats() = %+v, want the wrapped cache's", stats)
+	}
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get() error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestInstrumentedCache_RememberRefresh(t *testing.T) {
+	m := &metrics.CacheMetrics{}
+	c := NewInstrumentedCache(NewMemoryCache(Options{StaleWhileRevalidate: time.Minute}), InstrumentOptions{Name: "test", Metrics: m})
+	ctx := context.Background()
+
+	refreshed := make(chan struct{})
+	c.Remember(ctx, "k", 10*time.Millisecond, func() (interface{}, error) { return "v1", nil })
+	time.Sleep(20 * time.Millisecond)
+	value, err := c.Remember(ctx, "k", 10*time.Millisecond, func() (interface{}, error) {
+		defer close(refreshed)
+		return "v2", nil
+	})
+	if err != nil || value != "v1" {
+		t.Fatalf("Remember() = %v, %v, want the stale v1", value, err)
+	}
+	<-refreshed
+
+	// The stale value was served while the refresh ran in the background
+	if m.Hits != 1 || m.Misses != 1 {
+		t.Errorf("hits = %d, misses = %d, want 1 and 1", m.Hits, m.Misses)
+	}
+
+	m = &metrics.CacheMetrics{}
+	n := NewInstrumentedCache(NoopCache{}, InstrumentOptions{Name: "noop", Metrics: m})
+	n.Remember(ctx, "k", time.Minute, func() (interface{}, error) { return "v", nil })
+	if m.Misses != 1 {
+		t.Errorf("noop misses = %d, want 1", m.Misses)
+	}
+}
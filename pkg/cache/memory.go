@@ -3,8 +3,7 @@ package cache
 import (
 	"context"
 	"errors"
-	"math"
-	"sync"
+	"strings"
 	"time"
 )
 
@@ -13,24 +12,46 @@ var (
 	ErrKeyExpired  = errors.New("key expired")
 )
 
+// MemoryCache is an in-process cache split into lock-striped shards, so
+// that operations on different keys rarely contend
 type MemoryCache struct {
-	mu       sync.RWMutex
-	items    map[string]*Item
-	maxItems int
-	options  Options
+	shards  []*shard
+	mask    uint64
+	options Options
+	// loads is shared with WithPrefix views and keyed by prefixed key
+	loads *flight
 }
 
 type Item struct {
 	Value      interface{}
 	Expiration int64
-	Tags       []string
+	// Tags are the item's tags, namespaced by the prefix they were written
+	// under
+	Tags []string
+
+	key   string
+	size  int64
+	index int // position in the shard's expiry heap, or -1
+
+	// fresh is when a value written by Remember turns stale, and delta how
+	// long its loader took
+	fresh int64
+	delta time.Duration
 }
 
+// expireInterval is how often the cleanup loop removes expired items
+const expireInterval = time.Second
+
 func NewMemoryCache(opts Options) *MemoryCache {
+	count := shardCount(opts)
 	cache := &MemoryCache{
-		items:    make(map[string]*Item),
-		maxItems: opts.MaxEntries,
-		options:  opts,
+		shards:  make([]*shard, count),
+		mask:    uint64(count - 1),
+		options: opts,
+		loads:   &flight{},
+	}
+	for i := range cache.shards {
+		cache.shards[i] = newShard(cache, count)
 	}
 
 	// Start cleanup routine
@@ -40,128 +61,118 @@ func NewMemoryCache(opts Options) *MemoryCache {
 }
 
 func (c *MemoryCache) Get(ctx context.Context, key string) (interface{}, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	item, found := c.items[key]
-	if !found {
-		return nil, ErrKeyNotFound
-	}
-
-	if item.Expiration > 0 && item.Expiration < time.Now().UnixNano() {
-		return nil, ErrKeyExpired
+	key = c.prefixKey(key)
+	s := c.shard(key)
+	// Hits update the eviction policy, so even reads lock the shard
+	// exclusively
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.lookup(key)
+	if err != nil {
+		return nil, err
 	}
-
 	return item.Value, nil
 }
 
 func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.maxItems > 0 && len(c.items) >= c.maxItems {
-		c.evict()
-	}
-
-	var exp int64
-	if ttl > 0 {
-		exp = time.Now().Add(ttl).UnixNano()
-	}
-
-	c.items[key] = &Item{
+	return c.store(key, &Item{
 		Value:      value,
-		Expiration: exp,
-	}
-
-	return nil
+		Expiration: expiration(c.options.ttl(ttl)),
+	})
 }
 
 func (c *MemoryCache) cleanupLoop() {
-	ticker := time.NewTicker(time.Minute)
+	ticker := time.NewTicker(expireInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		c.mu.Lock()
-		now := time.Now().UnixNano()
-		for key, item := range c.items {
-			if item.Expiration > 0 && item.Expiration < now {
-				delete(c.items, key)
-			}
-		}
-		c.mu.Unlock()
+		c.expire(time.Now().UnixNano())
 	}
 }
 
-// evict removes the oldest item from the cache
-func (c *MemoryCache) evict() {
-	var oldestKey string
-	var oldestTime int64 = math.MaxInt64
-
-	for key, item := range c.items {
-		if item.Expiration < oldestTime {
-			oldestTime = item.Expiration
-			oldestKey = key
-		}
+// expire removes a batch of expired items from each shard in turn
+func (c *MemoryCache) expire(now int64) {
+	for _, s := range c.shards {
+		s.expire(now)
 	}
+}
 
-	if oldestKey != "" {
-		delete(c.items, oldestKey)
+// Stats returns a snapshot of the cache's counters, which cover every
+// prefix
+func (c *MemoryCache) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		s.mu.Lock()
+		stats.Hits += s.hits
+		stats.Misses += s.misses
+		stats.Sets += s.sets
+		stats.Errors += s.errors
+		stats.Evictions += s.evictions
+		stats.Expirations += s.expirations
+		stats.Entries += len(s.items)
+		stats.Memory += s.memory
+		s.mu.Unlock()
 	}
+	return stats
 }
 
-// Clear removes all items from the cache
-func (c *MemoryCache) Clear(ctx context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.items = make(map[string]*Item)
-	return nil
+func (i *Item) expired(now int64) bool {
+	return i.Expiration > 0 && i.Expiration < now
 }
 
-func (c *MemoryCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	item, found := c.items[key]
-	if !found {
-		return 0, ErrKeyNotFound
+func expiration(ttl time.Duration) int64 {
+	if ttl > 0 {
+		return time.Now().Add(ttl).UnixNano()
 	}
+	return 0
+}
 
-	current, ok := item.Value.(int64)
-	if !ok {
-		return 0, errors.New("value is not an integer")
+// Clear removes all items under the cache's prefix, or every item without
+// a prefix
+func (c *MemoryCache) Clear(ctx context.Context) error {
+	prefix := c.prefixKey("")
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if c.options.Prefix == "" {
+			s.reset()
+		} else {
+			for key := range s.items {
+				if strings.HasPrefix(key, prefix) {
+					s.remove(key)
+				}
+			}
+		}
+		s.mu.Unlock()
 	}
+	return nil
+}
 
-	current -= value
-	item.Value = current
-	return current, nil
+func (c *MemoryCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	return c.Increment(ctx, key, -value)
 }
 
 func (c *MemoryCache) Delete(ctx context.Context, key string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.items, key)
+	key = c.prefixKey(key)
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
 	return nil
 }
 
 func (c *MemoryCache) DeleteMany(ctx context.Context, keys []string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
 	for _, key := range keys {
-		delete(c.items, key)
+		c.Delete(ctx, key)
 	}
 	return nil
 }
 
 func (c *MemoryCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
 	results := make(map[string]interface{}, len(keys))
 	for _, key := range keys {
-		if item, found := c.items[key]; found {
-			if item.Expiration == 0 || item.Expiration > time.Now().UnixNano() {
-				results[key] = item.Value
-			}
+		if value, err := c.Get(ctx, key); err == nil {
+			results[key] = value
 		}
 	}
 	return results, nil
@@ -169,16 +180,19 @@ func (c *MemoryCache) GetMany(ctx context.Context, keys []string) (map[string]in
 
 // Increment atomically increments a numeric value
 func (c *MemoryCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	key = c.prefixKey(key)
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	item, found := c.items[key]
-	if !found {
-		return 0, ErrKeyNotFound
+	item, err := s.lookup(key)
+	if err != nil {
+		return 0, err
 	}
 
 	current, ok := item.Value.(int64)
 	if !ok {
+		s.errors++
 		return 0, errors.New("value is not an integer")
 	}
 
@@ -189,244 +203,274 @@ func (c *MemoryCache) Increment(ctx context.Context, key string, value int64) (i
 
 // SetMany sets multiple key-value pairs
 func (c *MemoryCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	var exp int64
-	if ttl > 0 {
-		exp = time.Now().Add(ttl).UnixNano()
-	}
-
+	exp := expiration(c.options.ttl(ttl))
 	for key, value := range items {
-		if c.maxItems > 0 && len(c.items) >= c.maxItems {
-			c.evict()
-		}
-		c.items[key] = &Item{
-			Value:      value,
-			Expiration: exp,
+		if err := c.store(key, &Item{Value: value, Expiration: exp}); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// Tags returns all items with the given tags
+// store stores an item in its prefixed key's shard
+func (c *MemoryCache) store(key string, item *Item) error {
+	key = c.prefixKey(key)
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store(key, item)
+}
+
+// Tags returns a view of the cache whose writes carry tags, so they can be
+// flushed together
 func (c *MemoryCache) Tags(tags ...string) TaggedCache {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = c.prefixKey(tag)
+	}
 	return &MemoryTaggedCache{
 		cache: c,
-		tags:  tags,
+		names: append([]string(nil), tags...),
+		tags:  keys,
 	}
 }
 
-// MemoryTaggedCache implements TaggedCache for memory cache
+// MemoryTaggedCache implements TaggedCache for memory cache. Each shard
+// indexes its keys by tag, so flushing a tag only visits its own keys.
 type MemoryTaggedCache struct {
 	cache *MemoryCache
-	tags  []string
+	names []string
+	// tags are the names namespaced by the cache's prefix
+	tags []string
 }
 
 func (t *MemoryTaggedCache) Get(ctx context.Context, key string) (interface{}, error) {
-	item, err := t.cache.Get(ctx, key)
+	key = t.cache.prefixKey(key)
+	s := t.cache.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.lookup(key)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if item has all required tags
-	if cacheItem, ok := t.cache.items[key]; ok {
-		if !t.hasAllTags(cacheItem.Tags) {
-			return nil, ErrKeyNotFound
-		}
+	if !t.hasAllTags(item.Tags) {
+		return nil, ErrKeyNotFound
 	}
 
-	return item, nil
+	return item.Value, nil
 }
 
 func (t *MemoryTaggedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	t.cache.mu.Lock()
-	defer t.cache.mu.Unlock()
-
-	if t.cache.maxItems > 0 && len(t.cache.items) >= t.cache.maxItems {
-		t.cache.evict()
-	}
-
-	var exp int64
-	if ttl > 0 {
-		exp = time.Now().Add(ttl).UnixNano()
-	}
-
-	t.cache.items[key] = &Item{
+	return t.cache.store(key, &Item{
 		Value:      value,
-		Expiration: exp,
+		Expiration: expiration(t.cache.options.ttl(ttl)),
 		Tags:       t.tags,
-	}
-
-	return nil
+	})
 }
 
 func (t *MemoryTaggedCache) hasAllTags(itemTags []string) bool {
-	if len(t.tags) == 0 {
-		return true
-	}
-	tagMap := make(map[string]bool)
-	for _, tag := range itemTags {
-		tagMap[tag] = true
-	}
 	for _, tag := range t.tags {
-		if !tagMap[tag] {
+		found := false
+		for _, itemTag := range itemTags {
+			if itemTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
 			return false
 		}
 	}
 	return true
 }
 
+// Clear removes every item carrying any of the view's tags, or everything
+// under the prefix for a view without tags
 func (t *MemoryTaggedCache) Clear(ctx context.Context) error {
-	t.cache.mu.Lock()
-	defer t.cache.mu.Unlock()
-
-	// Remove all items that have all the required tags
-	for key, item := range t.cache.items {
-		if t.hasAllTags(item.Tags) {
-			delete(t.cache.items, key)
-		}
+	if len(t.tags) == 0 {
+		return t.cache.Clear(ctx)
+	}
+	for _, s := range t.cache.shards {
+		s.mu.Lock()
+		s.flush(t.tags)
+		s.mu.Unlock()
 	}
 	return nil
 }
 
 func (t *MemoryTaggedCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
-	if item, ok := t.cache.items[key]; ok {
-		if !t.hasAllTags(item.Tags) {
-			return 0, ErrKeyNotFound
-		}
+	if !t.tagged(key) {
+		return 0, ErrKeyNotFound
 	}
 	return t.cache.Decrement(ctx, key, value)
 }
 
 func (t *MemoryTaggedCache) Delete(ctx context.Context, key string) error {
-	if item, ok := t.cache.items[key]; ok {
-		if !t.hasAllTags(item.Tags) {
-			return ErrKeyNotFound
-		}
+	if !t.tagged(key) {
+		return ErrKeyNotFound
 	}
 	return t.cache.Delete(ctx, key)
 }
 
-func (t *MemoryTaggedCache) DeleteMany(ctx context.Context, keys []string) error {
-	t.cache.mu.Lock()
-	defer t.cache.mu.Unlock()
+// tagged reports whether a missing key or one carrying all of the view's
+// tags may be operated on through the view
+func (t *MemoryTaggedCache) tagged(key string) bool {
+	key = t.cache.prefixKey(key)
+	s := t.cache.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	item, ok := s.items[key]
+	return !ok || t.hasAllTags(item.Tags)
+}
+
+func (t *MemoryTaggedCache) DeleteMany(ctx context.Context, keys []string) error {
 	for _, key := range keys {
-		if item, ok := t.cache.items[key]; ok {
-			if t.hasAllTags(item.Tags) {
-				delete(t.cache.items, key)
-			}
+		key = t.cache.prefixKey(key)
+		s := t.cache.shard(key)
+		s.mu.Lock()
+		if item, ok := s.items[key]; ok && t.hasAllTags(item.Tags) {
+			s.remove(key)
 		}
+		s.mu.Unlock()
 	}
 	return nil
 }
 
+// Flush removes every item carrying any of the view's tags
 func (t *MemoryTaggedCache) Flush(ctx context.Context) error {
 	return t.Clear(ctx)
 }
 
 func (t *MemoryTaggedCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
-	t.cache.mu.RLock()
-	defer t.cache.mu.RUnlock()
-
 	results := make(map[string]interface{})
 	for _, key := range keys {
-		if item, found := t.cache.items[key]; found {
-			if item.Expiration == 0 || item.Expiration > time.Now().UnixNano() {
-				if t.hasAllTags(item.Tags) {
-					results[key] = item.Value
-				}
-			}
+		if value, err := t.Get(ctx, key); err == nil {
+			results[key] = value
 		}
 	}
 	return results, nil
 }
 
 func (t *MemoryTaggedCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
-	if item, ok := t.cache.items[key]; ok {
-		if !t.hasAllTags(item.Tags) {
-			return 0, ErrKeyNotFound
-		}
+	if !t.tagged(key) {
+		return 0, ErrKeyNotFound
 	}
 	return t.cache.Increment(ctx, key, value)
 }
 
+// Remember returns the cached value for key, or stores and returns the
+// result of callback if the key is missing. Concurrent misses share one
+// callback run.
 func (t *MemoryTaggedCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
-	// Try to get from cache first
-	if value, err := t.Get(ctx, key); err == nil {
-		return value, nil
-	}
+	return remember(ctx, t, t.cache.loads, t.cache.options, t.cache.prefixKey(key), key, ttl, callback, nil)
+}
 
-	// Generate value using callback
-	value, err := callback()
-	if err != nil {
-		return nil, err
-	}
+func (t *MemoryTaggedCache) lookupEntry(ctx context.Context, key string, target func() interface{}) (entry, error) {
+	key = t.cache.prefixKey(key)
+	s := t.cache.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Store in cache
-	if err := t.Set(ctx, key, value, ttl); err != nil {
-		return nil, err
+	item, err := s.lookup(key)
+	if err != nil || !t.hasAllTags(item.Tags) {
+		return entry{}, nil
 	}
+	return item.entry(), nil
+}
 
-	return value, nil
+func (t *MemoryTaggedCache) storeEntry(ctx context.Context, key string, value interface{}, ttl, delta time.Duration) error {
+	return t.cache.store(key, t.cache.remembered(value, ttl, delta, t.tags))
 }
 
 func (t *MemoryTaggedCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
-	t.cache.mu.Lock()
-	defer t.cache.mu.Unlock()
-
-	var exp int64
-	if ttl > 0 {
-		exp = time.Now().Add(ttl).UnixNano()
-	}
-
+	exp := expiration(t.cache.options.ttl(ttl))
 	for key, value := range items {
-		if t.cache.maxItems > 0 && len(t.cache.items) >= t.cache.maxItems {
-			t.cache.evict()
-		}
-		t.cache.items[key] = &Item{
+		err := t.cache.store(key, &Item{
 			Value:      value,
 			Expiration: exp,
 			Tags:       t.tags,
+		})
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 func (t *MemoryTaggedCache) Tags(tags ...string) TaggedCache {
-	return &MemoryTaggedCache{
-		cache: t.cache,
-		tags:  append(t.tags, tags...),
-	}
+	return t.cache.Tags(append(append([]string(nil), t.names...), tags...)...)
 }
 
+// WithPrefix returns a view with the same tags, nested under prefix
 func (t *MemoryTaggedCache) WithPrefix(prefix string) Cache {
-	t.cache.options.Prefix = prefix
-	return t.cache
+	return t.cache.WithPrefix(prefix).Tags(t.names...)
 }
 
+// Remember returns the cached value for key, or stores and returns the
+// result of callback if the key is missing. Concurrent misses share one
+// callback run; see Options for the stale and early refresh modes.
 func (c *MemoryCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
-	// Try to get from cache first
-	if value, err := c.Get(ctx, key); err == nil {
-		return value, nil
-	}
+	return remember(ctx, c, c.loads, c.options, c.prefixKey(key), key, ttl, callback, nil)
+}
 
-	// Generate value using callback
-	value, err := callback()
+func (c *MemoryCache) lookupEntry(ctx context.Context, key string, target func() interface{}) (entry, error) {
+	key = c.prefixKey(key)
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.lookup(key)
 	if err != nil {
-		return nil, err
+		return entry{}, nil
 	}
+	return item.entry(), nil
+}
 
-	// Store in cache
-	if err := c.Set(ctx, key, value, ttl); err != nil {
-		return nil, err
+func (c *MemoryCache) storeEntry(ctx context.Context, key string, value interface{}, ttl, delta time.Duration) error {
+	return c.store(key, c.remembered(value, ttl, delta, nil))
+}
+
+// remembered builds an item for Remember, kept past its ttl for the stale
+// modes
+func (c *MemoryCache) remembered(value interface{}, ttl, delta time.Duration, tags []string) *Item {
+	return &Item{
+		Value:      value,
+		Expiration: expiration(c.options.retention(ttl)),
+		Tags:       tags,
+		fresh:      expiration(ttl),
+		delta:      delta,
 	}
+}
 
-	return value, nil
+func (i *Item) entry() entry {
+	e := entry{value: i.Value, found: true, delta: i.delta}
+	if i.fresh > 0 {
+		e.expires = time.Unix(0, i.fresh)
+	}
+	return e
 }
 
+// WithPrefix returns a view of the cache whose keys and tags are nested
+// under prefix. The view shares the shards and limits but not keys: its
+// Clear only removes its own keys.
 func (c *MemoryCache) WithPrefix(prefix string) Cache {
-	c.options.Prefix = prefix
-	return c
+	opts := c.options
+	opts.Prefix = c.prefixKey(prefix)
+	return &MemoryCache{
+		shards:  c.shards,
+		mask:    c.mask,
+		options: opts,
+		loads:   c.loads,
+	}
+}
+
+func (c *MemoryCache) prefixKey(key string) string {
+	if c.options.Prefix != "" {
+		return c.options.Prefix + ":" + key
+	}
+	return key
 }
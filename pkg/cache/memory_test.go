@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	tests := []struct {
+		policy  string
+		reads   []string
+		evicted string
+	}{
+		// a is read most recently, so b is least recently used
+		{EvictionLRU, []string{"b", "a"}, "c"},
+		{EvictionLRU, []string{"a", "c"}, "b"},
+		// b is read twice, a once, c never
+		{EvictionLFU, []string{"b", "a", "b"}, "c"},
+		{EvictionLFU, []string{"c", "c", "b"}, "a"},
+		// Keys read twice move to ARC's frequent list; a one-off key is
+		// evicted first
+		{EvictionARC, []string{"a", "b"}, "c"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("%s/%v", tt.policy, tt.reads), func(t *testing.T) {
+			var evicted []string
+			c := NewMemoryCache(Options{
+				MaxEntries: 3,
+				Eviction:   tt.policy,
+				OnEvict:    func(key string, value interface{}) { evicted = append(evicted, key) },
+			})
+			ctx := context.Background()
+
+			// Ordered with ttls so the old expiration-based eviction would
+			// pick a never-expiring entry
+			c.Set(ctx, "a", 1, 0)
+			c.Set(ctx, "b", 2, time.Hour)
+			c.Set(ctx, "c", 3, time.Minute)
+			for _, key := range tt.reads {
+				if _, err := c.Get(ctx, key); err != nil {
+					t.Fatalf("Get(%s) error = %v", key, err)
+				}
+			}
+			c.Set(ctx, "d", 4, 0)
+
+			if len(evicted) != 1 || evicted[0] != tt.evicted {
+				t.Errorf("evicted = %v, want [%s]", evicted, tt.evicted)
+			}
+			if _, err := c.Get(ctx, tt.evicted); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Get(%s) error = %v, want ErrKeyNotFound", tt.evicted, err)
+			}
+			if stats := c.Stats(); stats.Entries != 3 || stats.Evictions != 1 {
+				t.Errorf("Stats() = %+v, want 3 entries and 1 eviction", stats)
+			}
+		})
+	}
+}
+
+func TestARC_ScanResistance(t *testing.T) {
+	p := newARC(4)
+	resident := map[string]bool{}
+	add := func(key string) {
+		if resident[key] {
+			p.access(key)
+			return
+		}
+		if len(resident) >= 4 {
+			victim, _ := p.victim()
+			delete(resident, victim)
+		}
+		p.add(key)
+		resident[key] = true
+	}
+
+	// A hot working set read repeatedly
+	for i := 0; i < 3; i++ {
+		add("hot1")
+		add("hot2")
+	}
+	// A long scan of one-off keys
+	for i := 0; i < 20; i++ {
+		add(fmt.Sprintf("scan%d", i))
+	}
+
+	if !resident["hot1"] || !resident["hot2"] {
+		t.Errorf("resident after scan = %v, want hot keys kept", resident)
+	}
+}
+
+type blob int64
+
+func (b blob) Size() int64 { return int64(b) }
+
+func TestMemoryCache_MaxMemory(t *testing.T) {
+	ctx := context.Background()
+	// Each entry below is 1000 bytes plus a one-byte key and the overhead
+	entry := int64(1000 + 1 + entryOverhead)
+	c := NewMemoryCache(Options{MaxMemory: 3 * entry})
+
+	c.Set(ctx, "a", make([]byte, 1000), 0)
+	c.Set(ctx, "b", string(make([]byte, 1000)), 0)
+	c.Set(ctx, "c", blob(1000), 0)
+	if stats := c.Stats(); stats.Memory != 3*entry || stats.Evictions != 0 {
+		t.Fatalf("Stats() = %+v, want %d bytes and no evictions", stats, 3*entry)
+	}
+
+	// Replacing an entry releases its old size first
+	c.Set(ctx, "a", make([]byte, 1000), 0)
+	if stats := c.Stats(); stats.Evictions != 0 {
+		t.Errorf("Stats() after replace = %+v, want no evictions", stats)
+	}
+
+	// A double-size entry evicts the two least recently used
+	c.Set(ctx, "d", blob(2000+1+entryOverhead), 0)
+	for key, want := range map[string]bool{"a": true, "b": false, "c": false, "d": true} {
+		if _, err := c.Get(ctx, key); (err == nil) != want {
+			t.Errorf("Get(%s) error = %v, want present = %v", key, err, want)
+		}
+	}
+	if stats := c.Stats(); stats.Memory > 3*entry || stats.Evictions != 2 {
+		t.Errorf("Stats() = %+v, want at most %d bytes and 2 evictions", stats, 3*entry)
+	}
+
+	if err := c.Set(ctx, "huge", blob(4*entry), 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Set() of an oversized value error = %v, want ErrValueTooLarge", err)
+	}
+
+	c.Delete(ctx, "a")
+	c.Clear(ctx)
+	if stats := c.Stats(); stats.Memory != 0 {
+		t.Errorf("Stats() after Clear() = %+v, want 0 bytes", stats)
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want int
+	}{
+		{Options{Shards: 8}, 8},
+		{Options{Shards: 6}, 4},
+		{Options{Shards: 16, MaxEntries: 200}, 2},
+		{Options{Shards: 16, MaxEntries: 3}, 1},
+		{Options{Shards: 16, MaxMemory: 4 << 20}, 4},
+	}
+
+	for _, tt := range tests {
+		if got := shardCount(tt.opts); got != tt.want {
+			t.Errorf("shardCount(%+v) = %d, want %d", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryCache_IncrementalExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(Options{Shards: 4})
+
+	c.Set(ctx, "kept", "x", 0)
+	c.Set(ctx, "later", "x", time.Hour)
+	for i := 0; i < 2000; i++ {
+		c.Set(ctx, fmt.Sprintf("key%d", i), i, time.Minute)
+	}
+
+	// Each pass removes at most a batch per shard
+	later := time.Now().Add(30 * time.Minute).UnixNano()
+	c.expire(later)
+	if stats := c.Stats(); stats.Expirations != 4*expireBatch {
+		t.Fatalf("Stats() after one pass = %+v, want %d expirations", stats, 4*expireBatch)
+	}
+
+	for i := 0; i < 2; i++ {
+		c.expire(later)
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Expirations != 2000 {
+		t.Errorf("Stats() = %+v, want 2 entries and 2000 expirations", stats)
+	}
+	for _, key := range []string{"kept", "later"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Errorf("Get(%s) error = %v", key, err)
+		}
+	}
+}
+
+func TestMemoryCache_RememberSingleflight(t *testing.T) {
+	c := NewMemoryCache(Options{})
+	ctx := context.Background()
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Remember(ctx, "key", time.Minute, loader); err != nil || v != "value" {
+				t.Errorf("Remember() = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+}
+
+func TestMemoryCache_RememberStale(t *testing.T) {
+	failing := func() (interface{}, error) { return nil, errors.New("backend down") }
+	tests := []struct {
+		name    string
+		opts    Options
+		loader  func() (interface{}, error)
+		want    interface{}
+		wantErr bool
+	}{
+		{"no stale modes", Options{}, failing, nil, true},
+		{"stale while revalidate", Options{StaleWhileRevalidate: time.Minute}, failing, "old", false},
+		{"stale if error", Options{StaleIfError: time.Minute}, failing, "old", false},
+		{"stale if error refreshes", Options{StaleIfError: time.Minute}, func() (interface{}, error) { return "new", nil }, "new", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(tt.opts)
+			ctx := context.Background()
+
+			c.Remember(ctx, "key", 10*time.Millisecond, func() (interface{}, error) { return "old", nil })
+			time.Sleep(20 * time.Millisecond)
+
+			got, err := c.Remember(ctx, "key", time.Minute, tt.loader)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Remember() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCache_RememberRevalidates(t *testing.T) {
+	c := NewMemoryCache(Options{StaleWhileRevalidate: time.Minute})
+	ctx := context.Background()
+
+	c.Remember(ctx, "key", 10*time.Millisecond, func() (interface{}, error) { return "old", nil })
+	time.Sleep(20 * time.Millisecond)
+
+	refreshed := make(chan struct{})
+	v, _ := c.Remember(ctx, "key", time.Minute, func() (interface{}, error) {
+		defer close(refreshed)
+		return "new", nil
+	})
+	if v != "old" {
+		t.Errorf("Remember() = %v, want the stale value", v)
+	}
+
+	<-refreshed
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := c.Get(ctx, "key"); v != "new" {
+		t.Errorf("Get() after refresh = %v, want new", v)
+	}
+}
+
+func TestRefreshEarly(t *testing.T) {
+	tests := []struct {
+		remaining, delta time.Duration
+		beta             float64
+		want             bool
+	}{
+		{time.Minute, time.Second, 0, false},
+		{time.Minute, 0, 1, false},
+		// Far from expiry relative to the loader's duration
+		{time.Hour, time.Millisecond, 1, false},
+		// Already at expiry
+		{0, time.Second, 1, true},
+	}
+
+	for _, tt := range tests {
+		if got := refreshEarly(tt.remaining, tt.delta, tt.beta); got != tt.want {
+			t.Errorf("refreshEarly(%v, %v, %v) = %v, want %v", tt.remaining, tt.delta, tt.beta, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"neuron/pkg/config"
+)
+
+// Module builds the cache described by a CacheConfig when the engine
+// starts, and closes it on shutdown
+type Module struct {
+	config  config.CacheConfig
+	factory *Factory
+
+	mu    sync.RWMutex
+	cache Cache
+}
+
+// NewModule creates a cache module. A nil factory uses the built-in
+// drivers.
+func NewModule(cfg config.CacheConfig, factory *Factory) *Module {
+	if factory == nil {
+		factory = NewFactory()
+	}
+	return &Module{config: cfg, factory: factory}
+}
+
+// Name implements the engine's Module interface
+func (m *Module) Name() string {
+	return "cache"
+}
+
+// Init creates the cache
+func (m *Module) Init(ctx context.Context) error {
+	c, err := m.factory.Create(m.config)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cache = c
+	m.mu.Unlock()
+	return nil
+}
+
+// Shutdown closes the cache's connections, if it has any
+func (m *Module) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	closer, ok := m.cache.(io.Closer)
+	m.cache = nil
+	if ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Check pings caches backed by a server, so the engine's readiness check
+// covers the cache
+func (m *Module) Check(ctx context.Context) error {
+	c := m.Cache()
+	if c == nil {
+		return errors.New("cache is not running")
+	}
+	if pinger, ok := c.(interface{ Ping(context.Context) error }); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Cache returns the cache, or nil while the module is not running
+func (m *Module) Cache() Cache {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cache
+}
@@ -2,21 +2,72 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// clearBatchSize is the SCAN count and the number of keys unlinked at once
+// by Clear
+const clearBatchSize = 500
+
+// statsTimeout bounds the server queries made by Stats
+const statsTimeout = time.Second
+
+// ErrNoPrefix is returned by Clear on a Redis cache without a prefix,
+// which would otherwise remove every key in the database
+var ErrNoPrefix = errors.New("cannot clear a redis cache without a prefix")
+
+var _ Cache = (*RedisCache)(nil)
+
+// RedisCache is a cache stored in Redis: a single server, a Sentinel
+// failover group or a Cluster
 type RedisCache struct {
-	client  *redis.Client
+	client  redis.UniversalClient
 	options Options
+	// loads is shared with WithPrefix views and keyed by prefixed key
+	loads *flight
+	// stats is shared with WithPrefix and Tags views
+	stats *counters
+}
+
+// counters are a RedisCache's operation counts
+type counters struct {
+	hits, misses, sets, errors atomic.Uint64
+}
+
+// fail counts an error and returns it
+func (s *counters) fail(err error) error {
+	s.errors.Add(1)
+	return err
+}
+
+// lookups counts the hits and misses of reading n keys
+func (s *counters) lookups(n, found int) {
+	s.hits.Add(uint64(found))
+	s.misses.Add(uint64(n - found))
 }
 
 func NewRedisCache(opts Options, redisOpts *redis.Options) (*RedisCache, error) {
 	client := redis.NewClient(redisOpts)
+	c, err := NewRedisCacheWithClient(opts, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return c, nil
+}
 
+// NewRedisCacheWithClient creates a cache on an existing client, such as a
+// *redis.ClusterClient or a Sentinel-backed *redis.Client
+func NewRedisCacheWithClient(opts Options, client redis.UniversalClient) (*RedisCache, error) {
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -28,43 +79,490 @@ func NewRedisCache(opts Options, redisOpts *redis.Options) (*RedisCache, error)
 	return &RedisCache{
 		client:  client,
 		options: opts,
+		loads:   &flight{},
+		stats:   &counters{},
 	}, nil
 }
 
 func (c *RedisCache) Get(ctx context.Context, key string) (interface{}, error) {
-	key = c.prefixKey(key)
+	return c.getTyped(ctx, key, nil)
+}
 
-	val, err := c.client.Get(ctx, key).Result()
-	if err == redis.Nil {
+func (c *RedisCache) getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error) {
+	results, err := c.read(ctx, []string{key}, target, false)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[key]
+	if !ok {
 		return nil, ErrKeyNotFound
 	}
+	return result.value, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	prefixed := c.prefixKey(key)
+	ttl = c.options.ttl(ttl)
+
+	data, err := c.serialize(value)
 	if err != nil {
-		return nil, &CacheError{Op: "get", Key: key, Err: err}
+		return c.stats.fail(&CacheError{Op: "serialize", Key: prefixed, Err: err})
 	}
 
-	var result interface{}
-	if err := c.deserialize([]byte(val), &result); err != nil {
-		return nil, &CacheError{Op: "deserialize", Key: key, Err: err}
+	if !c.options.tracksFreshness() {
+		if err := c.client.Set(ctx, prefixed, data, ttl).Err(); err != nil {
+			return c.stats.fail(&CacheError{Op: "set", Key: prefixed, Err: err})
+		}
+		c.stats.sets.Add(1)
+		return nil
 	}
 
-	return result, nil
+	// A plain write replaces whatever Remember knew about the old value
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, prefixed, data, ttl)
+	pipe.Del(ctx, c.freshKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return c.stats.fail(&CacheError{Op: "set", Key: prefixed, Err: err})
+	}
+	c.stats.sets.Add(1)
+	return nil
 }
 
-func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+// Delete removes a key
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	key = c.prefixKey(key)
+	if err := c.client.Del(ctx, key).Err(); err != nil {
+		return c.stats.fail(&CacheError{Op: "delete", Key: key, Err: err})
+	}
+	return nil
+}
 
-	data, err := c.serialize(value)
+// Clear removes every key under the cache's prefix. It walks the keyspace
+// with SCAN rather than FLUSHDB, so other data in the database survives.
+// A cache without a prefix cannot tell its keys from others', so Clear
+// returns ErrNoPrefix.
+func (c *RedisCache) Clear(ctx context.Context) error {
+	if c.options.Prefix == "" {
+		return ErrNoPrefix
+	}
+	pattern := escapeGlob(c.options.Prefix) + ":*"
+
+	cluster, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return c.clear(ctx, c.client, pattern)
+	}
+	// Each master holds its own share of the keys
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return c.clear(ctx, node, pattern)
+	})
+}
+
+// clear scans one server for keys matching pattern and unlinks them in
+// batches
+func (c *RedisCache) clear(ctx context.Context, node redis.Cmdable, pattern string) error {
+	iter := node.Scan(ctx, 0, pattern, clearBatchSize).Iterator()
+	batch := make([]string, 0, clearBatchSize)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == clearBatchSize {
+			if err := c.unlink(ctx, batch); err != nil {
+				return c.stats.fail(&CacheError{Op: "clear", Key: pattern, Err: err})
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return c.stats.fail(&CacheError{Op: "clear", Key: pattern, Err: err})
+	}
+	if len(batch) > 0 {
+		if err := c.unlink(ctx, batch); err != nil {
+			return c.stats.fail(&CacheError{Op: "clear", Key: pattern, Err: err})
+		}
+	}
+	return nil
+}
+
+// unlink removes keys in one round trip. On a cluster the keys may hash to
+// different slots, so each gets its own command.
+func (c *RedisCache) unlink(ctx context.Context, keys []string) error {
+	if !c.cluster() {
+		return c.client.Unlink(ctx, keys...).Err()
+	}
+
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Unlink(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// cluster reports whether the client is a Redis Cluster client, which
+// rejects multi-key commands spanning slots
+func (c *RedisCache) cluster() bool {
+	_, ok := c.client.(*redis.ClusterClient)
+	return ok
+}
+
+// GetMany returns the values of the keys that exist, in one round trip
+// plus one for keys written through a tagged view
+func (c *RedisCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	results, err := c.read(ctx, keys, nil, false)
 	if err != nil {
-		return &CacheError{Op: "serialize", Key: key, Err: err}
+		return nil, err
 	}
+	values := make(map[string]interface{}, len(results))
+	for key, result := range results {
+		values[key] = result.value
+	}
+	return values, nil
+}
 
-	if err := c.client.Set(ctx, key, data, ttl).Err(); err != nil {
-		return &CacheError{Op: "set", Key: key, Err: err}
+// fetch reads the keys that exist along with their remaining TTLs, zero
+// for keys that do not expire
+func (c *RedisCache) fetch(ctx context.Context, keys []string, target func() interface{}) (map[string]interface{}, map[string]time.Duration, error) {
+	results, err := c.read(ctx, keys, target, true)
+	if err != nil {
+		return nil, nil, err
 	}
+	values := make(map[string]interface{}, len(results))
+	remaining := make(map[string]time.Duration, len(results))
+	for key, result := range results {
+		values[key] = result.value
+		if result.ttl > 0 {
+			remaining[key] = result.ttl
+		}
+	}
+	return values, remaining, nil
+}
 
+// readResult is a live value read by read
+type readResult struct {
+	value  interface{}
+	stamps []stamp
+	ttl    time.Duration
+}
+
+// read returns the live values of the keys that exist, with their tag
+// stamps and, if ttls is set, remaining TTLs
+func (c *RedisCache) read(ctx context.Context, keys []string, target func() interface{}, ttls bool) (map[string]readResult, error) {
+	results := make(map[string]readResult, len(keys))
+	if len(keys) == 0 {
+		return results, nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefixKey(key)
+	}
+
+	raw := make(map[string][]byte, len(keys))
+	remaining := make(map[string]time.Duration)
+	if ttls || c.cluster() {
+		// Pipelined GETs, which a cluster client routes by slot
+		pipe := c.client.Pipeline()
+		gets := make([]*redis.StringCmd, len(keys))
+		pttls := make([]*redis.DurationCmd, len(keys))
+		for i, key := range prefixed {
+			gets[i] = pipe.Get(ctx, key)
+			if ttls {
+				pttls[i] = pipe.PTTL(ctx, key)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, c.stats.fail(&CacheError{Op: "get", Key: strings.Join(prefixed, ","), Err: err})
+		}
+		for i, key := range prefixed {
+			if data, err := gets[i].Bytes(); err == nil {
+				raw[key] = data
+				if ttls {
+					remaining[key] = pttls[i].Val()
+				}
+			}
+		}
+	} else {
+		values, err := c.client.MGet(ctx, prefixed...).Result()
+		if err != nil {
+			return nil, c.stats.fail(&CacheError{Op: "get", Key: strings.Join(prefixed, ","), Err: err})
+		}
+		for i, value := range values {
+			if data, ok := value.(string); ok {
+				raw[prefixed[i]] = []byte(data)
+			}
+		}
+	}
+
+	records, err := c.open(ctx, raw)
+	if err != nil {
+		return nil, c.stats.fail(&CacheError{Op: "get", Key: strings.Join(prefixed, ","), Err: err})
+	}
+	for i, key := range keys {
+		rec, ok := records[prefixed[i]]
+		if !ok {
+			continue
+		}
+		value, err := c.deserialize(rec.data, target)
+		if err != nil {
+			return nil, c.stats.fail(&CacheError{Op: "deserialize", Key: prefixed[i], Err: err})
+		}
+		results[key] = readResult{value: value, stamps: rec.stamps, ttl: remaining[prefixed[i]]}
+	}
+	c.stats.lookups(len(keys), len(results))
+	return results, nil
+}
+
+// SetMany stores several values with the same TTL in one pipeline
+func (c *RedisCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	ttl = c.options.ttl(ttl)
+	pipe := c.client.Pipeline()
+	for key, value := range items {
+		prefixed := c.prefixKey(key)
+		data, err := c.serialize(value)
+		if err != nil {
+			return c.stats.fail(&CacheError{Op: "serialize", Key: prefixed, Err: err})
+		}
+		pipe.Set(ctx, prefixed, data, ttl)
+		if c.options.tracksFreshness() {
+			pipe.Del(ctx, c.freshKey(key))
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return c.stats.fail(&CacheError{Op: "set", Key: "*", Err: err})
+	}
+	c.stats.sets.Add(uint64(len(items)))
+	return nil
+}
+
+// DeleteMany removes several keys in one round trip
+func (c *RedisCache) DeleteMany(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefixKey(key)
+	}
+	if err := c.unlink(ctx, prefixed); err != nil {
+		return c.stats.fail(&CacheError{Op: "delete", Key: strings.Join(prefixed, ","), Err: err})
+	}
 	return nil
 }
 
+// Remember returns the cached value for key, or stores and returns the
+// result of callback if the key is missing. Concurrent misses in this
+// process share one callback run; see Options for the stale and early
+// refresh modes.
+func (c *RedisCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
+	return c.rememberTyped(ctx, key, ttl, callback, nil)
+}
+
+func (c *RedisCache) rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	return remember(ctx, c, c.loads, c.options, c.prefixKey(key), key, ttl, callback, target)
+}
+
+func (c *RedisCache) lookupEntry(ctx context.Context, key string, target func() interface{}) (entry, error) {
+	e, _, err := c.lookup(ctx, key, target)
+	return e, err
+}
+
+// lookup reads a value with its tag stamps and the freshness metadata
+// Remember stored in a marker key beside it
+func (c *RedisCache) lookup(ctx context.Context, key string, target func() interface{}) (entry, []stamp, error) {
+	prefixed := c.prefixKey(key)
+
+	pipe := c.client.Pipeline()
+	valueCmd := pipe.Get(ctx, prefixed)
+	freshCmd := pipe.Get(ctx, c.freshKey(key))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return entry{}, nil, c.stats.fail(&CacheError{Op: "get", Key: prefixed, Err: err})
+	}
+
+	data, err := valueCmd.Bytes()
+	if err == redis.Nil {
+		c.stats.lookups(1, 0)
+		return entry{}, nil, nil
+	}
+	if err != nil {
+		return entry{}, nil, c.stats.fail(&CacheError{Op: "get", Key: prefixed, Err: err})
+	}
+
+	records, err := c.open(ctx, map[string][]byte{prefixed: data})
+	if err != nil {
+		return entry{}, nil, c.stats.fail(&CacheError{Op: "get", Key: prefixed, Err: err})
+	}
+	rec, ok := records[prefixed]
+	if !ok {
+		c.stats.lookups(1, 0)
+		return entry{}, nil, nil
+	}
+
+	e := entry{found: true}
+	if e.value, err = c.deserialize(rec.data, target); err != nil {
+		return entry{}, nil, c.stats.fail(&CacheError{Op: "deserialize", Key: prefixed, Err: err})
+	}
+	c.stats.lookups(1, 1)
+
+	var expires int64
+	if marker, err := freshCmd.Result(); err == nil {
+		if _, err := fmt.Sscanf(marker, "%d:%d", &expires, &e.delta); err == nil {
+			e.expires = time.Unix(0, expires)
+		}
+	}
+	return e, rec.stamps, nil
+}
+
+func (c *RedisCache) storeEntry(ctx context.Context, key string, value interface{}, ttl, delta time.Duration) error {
+	return c.storeRemembered(ctx, key, value, ttl, delta, nil)
+}
+
+// storeRemembered writes a value for Remember, kept past its ttl for the
+// stale modes, with a marker recording when it turns stale
+func (c *RedisCache) storeRemembered(ctx context.Context, key string, value interface{}, ttl, delta time.Duration, tags []string) error {
+	prefixed := c.prefixKey(key)
+	data, err := c.serialize(value)
+	if err != nil {
+		return c.stats.fail(&CacheError{Op: "serialize", Key: prefixed, Err: err})
+	}
+	stamps, err := c.stamps(ctx, tags)
+	if err != nil {
+		return c.stats.fail(&CacheError{Op: "set", Key: prefixed, Err: err})
+	}
+
+	retention := c.options.retention(ttl)
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, prefixed, wrapTagged(stamps, data), retention)
+	if c.options.tracksFreshness() && ttl > 0 {
+		marker := fmt.Sprintf("%d:%d", time.Now().Add(ttl).UnixNano(), delta)
+		pipe.Set(ctx, c.freshKey(key), marker, retention)
+	} else if c.options.tracksFreshness() {
+		pipe.Del(ctx, c.freshKey(key))
+	}
+	c.index(ctx, pipe, prefixed, stamps, retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return c.stats.fail(&CacheError{Op: "set", Key: prefixed, Err: err})
+	}
+	c.stats.sets.Add(1)
+	return nil
+}
+
+// Increment atomically adds value to an integer key, starting from zero if
+// the key does not exist
+func (c *RedisCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
+	key = c.prefixKey(key)
+	result, err := c.client.IncrBy(ctx, key, value).Result()
+	if err != nil {
+		return 0, c.stats.fail(&CacheError{Op: "increment", Key: key, Err: err})
+	}
+	return result, nil
+}
+
+// Decrement atomically subtracts value from an integer key
+func (c *RedisCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	key = c.prefixKey(key)
+	result, err := c.client.DecrBy(ctx, key, value).Result()
+	if err != nil {
+		return 0, c.stats.fail(&CacheError{Op: "decrement", Key: key, Err: err})
+	}
+	return result, nil
+}
+
+// WithPrefix returns a view of the cache whose keys are nested under
+// prefix. The view shares the connection but not keys: its Clear only
+// removes its own keys.
+func (c *RedisCache) WithPrefix(prefix string) Cache {
+	opts := c.options
+	opts.Prefix = c.prefixKey(prefix)
+	return &RedisCache{
+		client:  c.client,
+		options: opts,
+		loads:   c.loads,
+		stats:   c.stats,
+	}
+}
+
+// Tags returns a view of the cache whose writes are tagged, so they can be
+// flushed together
+func (c *RedisCache) Tags(tags ...string) TaggedCache {
+	return &RedisTaggedCache{
+		cache: c,
+		tags:  append([]string(nil), tags...),
+	}
+}
+
+// Ping checks the connection to the Redis server
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the client, which WithPrefix and Tags views share
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// Stats returns the operations counted by this process, with the entry
+// count, memory use, evictions and expirations reported by the server.
+// Those cover the whole database rather than the prefix, and are left zero
+// if the server does not answer within statsTimeout.
+func (c *RedisCache) Stats() Stats {
+	stats := Stats{
+		Hits:   c.stats.hits.Load(),
+		Misses: c.stats.misses.Load(),
+		Sets:   c.stats.sets.Load(),
+		Errors: c.stats.errors.Load(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	if size, err := c.client.DBSize(ctx).Result(); err == nil {
+		stats.Entries = int(size)
+	}
+
+	var mu sync.Mutex
+	info := func(ctx context.Context, node redis.Cmdable) error {
+		text, err := node.Info(ctx).Result()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		addInfo(&stats, text)
+		return nil
+	}
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return info(ctx, node)
+		})
+	} else {
+		info(ctx, c.client)
+	}
+	return stats
+}
+
+// addInfo adds the memory and keyspace counters of an INFO reply to stats
+func addInfo(stats *Stats, info string) {
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "used_memory":
+			stats.Memory += int64(n)
+		case "evicted_keys":
+			stats.Evictions += n
+		case "expired_keys":
+			stats.Expirations += n
+		}
+	}
+}
+
 func (c *RedisCache) prefixKey(key string) string {
 	if c.options.Prefix != "" {
 		return c.options.Prefix + ":" + key
@@ -72,22 +570,65 @@ func (c *RedisCache) prefixKey(key string) string {
 	return key
 }
 
+// tagKey holds the version of tag, which flushing the tag increments
+func (c *RedisCache) tagKey(tag string) string {
+	return c.prefixKey("__tags:" + tag)
+}
+
+// freshKey is the marker holding when a value written by Remember turns
+// stale, and how long its loader took
+func (c *RedisCache) freshKey(key string) string {
+	return c.prefixKey("__fresh:" + key)
+}
+
+// serialize encodes a value with SerializeFunc or the codec, then
+// compresses it if configured
 func (c *RedisCache) serialize(value interface{}) ([]byte, error) {
+	var data []byte
+	var err error
 	if c.options.SerializeFunc != nil {
-		return c.options.SerializeFunc(value)
+		data, err = c.options.SerializeFunc(value)
+	} else {
+		data, err = c.options.codec().Marshal(value)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return json.Marshal(value)
+	return compress(data, c.options)
 }
 
-func (c *RedisCache) deserialize(data []byte, value interface{}) error {
-	if c.options.DeserializeFunc != nil {
-		v, err := c.options.DeserializeFunc(data)
-		if err != nil {
-			return err
+// deserialize decompresses and decodes a value, into a new target value if
+// target is set
+func (c *RedisCache) deserialize(data []byte, target func() interface{}) (interface{}, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.options.DeserializeFunc == nil {
+		return decodeInto(data, target, c.options.codec().Unmarshal)
+	}
+
+	v, err := c.options.DeserializeFunc(data)
+	if err != nil || target == nil {
+		return v, err
+	}
+	ptr := target()
+	if err := assign(ptr, v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
+}
+
+// escapeGlob escapes the characters SCAN MATCH treats as patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
 		}
-		// Copy deserialized value to the provided pointer
-		*(value.(*interface{})) = v
-		return nil
+		b.WriteRune(r)
 	}
-	return json.Unmarshal(data, value)
+	return b.String()
 }
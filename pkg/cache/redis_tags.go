@@ -0,0 +1,532 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// taggedMagic starts every value written through a tagged view, followed
+// by the stamps of its tags. Like compressedMagic, no codec output starts
+// with it; a compressed payload follows the stamps.
+var taggedMagic = []byte{0x00, 'T'}
+
+// stamp records the version a tag had when a value was written. The value
+// is live while every one of its tags still has that version.
+type stamp struct {
+	tag     string // the tag's version key
+	version int64
+}
+
+// wrapTagged prefixes data with its tag stamps
+func wrapTagged(stamps []stamp, data []byte) []byte {
+	if len(stamps) == 0 {
+		return data
+	}
+
+	out := append([]byte(nil), taggedMagic...)
+	out = binary.AppendUvarint(out, uint64(len(stamps)))
+	for _, s := range stamps {
+		out = binary.AppendUvarint(out, uint64(len(s.tag)))
+		out = append(out, s.tag...)
+		out = binary.AppendVarint(out, s.version)
+	}
+	return append(out, data...)
+}
+
+// unwrapTagged splits a value written by wrapTagged into its stamps and
+// data. Untagged values are returned as they are.
+func unwrapTagged(data []byte) ([]stamp, []byte, error) {
+	if len(data) <= len(taggedMagic) || !bytes.HasPrefix(data, taggedMagic) {
+		return nil, data, nil
+	}
+
+	invalid := errors.New("invalid tag header")
+	rest := data[len(taggedMagic):]
+	count, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return nil, nil, invalid
+	}
+	rest = rest[n:]
+
+	stamps := make([]stamp, 0, count)
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(rest)
+		if n <= 0 || uint64(len(rest)-n) < size {
+			return nil, nil, invalid
+		}
+		tag := string(rest[n : n+int(size)])
+		rest = rest[n+int(size):]
+
+		version, n := binary.Varint(rest)
+		if n <= 0 {
+			return nil, nil, invalid
+		}
+		rest = rest[n:]
+		stamps = append(stamps, stamp{tag: tag, version: version})
+	}
+	return stamps, rest, nil
+}
+
+// membersKey is the set of keys written while a tag had the stamp's
+// version, which flushing the tag removes
+func membersKey(s stamp) string {
+	return s.tag + ":" + strconv.FormatInt(s.version, 10)
+}
+
+// versions returns the current version of each tag version key, zero for
+// tags never flushed
+func (c *RedisCache) versions(ctx context.Context, tagKeys []string) (map[string]int64, error) {
+	pipe := c.client.Pipeline()
+	cmds := make(map[string]*redis.StringCmd, len(tagKeys))
+	for _, key := range tagKeys {
+		if _, ok := cmds[key]; !ok {
+			cmds[key] = pipe.Get(ctx, key)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(cmds))
+	for key, cmd := range cmds {
+		if version, err := cmd.Int64(); err == nil {
+			versions[key] = version
+		}
+	}
+	return versions, nil
+}
+
+// stamps returns the current stamps of tags, for a write
+func (c *RedisCache) stamps(ctx context.Context, tags []string) ([]stamp, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	tagKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		tagKeys[i] = c.tagKey(tag)
+	}
+	versions, err := c.versions(ctx, tagKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	stamps := make([]stamp, len(tagKeys))
+	for i, key := range tagKeys {
+		stamps[i] = stamp{tag: key, version: versions[key]}
+	}
+	return stamps, nil
+}
+
+// KEYS: members
+// ARGV: prefixed key, ttl in milliseconds (0 for none)
+var indexScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+	return 1
+end
+local current = redis.call('PTTL', KEYS[1])
+if existed == 0 or (current >= 0 and current < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// index queues adding a prefixed key written with ttl to the member sets
+// of its stamps. A set expires with the longest-lived value written under
+// it, so the sets of tags that are never flushed do not grow forever.
+func (c *RedisCache) index(ctx context.Context, pipe redis.Pipeliner, prefixed string, stamps []stamp, ttl time.Duration) {
+	for _, s := range stamps {
+		indexScript.Eval(ctx, pipe, []string{membersKey(s)}, prefixed, ttl.Milliseconds())
+	}
+}
+
+// record is a stored value with its tag header removed
+type record struct {
+	data   []byte
+	stamps []stamp
+}
+
+// open strips the tag headers of raw values, keyed by prefixed key, and
+// drops the values whose tags were flushed since they were written. Those
+// are unlinked as they are found.
+func (c *RedisCache) open(ctx context.Context, raw map[string][]byte) (map[string]record, error) {
+	records := make(map[string]record, len(raw))
+	var tagKeys []string
+	for key, data := range raw {
+		stamps, payload, err := unwrapTagged(data)
+		if err != nil {
+			return nil, err
+		}
+		records[key] = record{data: payload, stamps: stamps}
+		for _, s := range stamps {
+			tagKeys = append(tagKeys, s.tag)
+		}
+	}
+	if len(tagKeys) == 0 {
+		return records, nil
+	}
+
+	versions, err := c.versions(ctx, tagKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for key, rec := range records {
+		for _, s := range rec.stamps {
+			if versions[s.tag] != s.version {
+				delete(records, key)
+				stale = append(stale, key)
+				break
+			}
+		}
+	}
+	if len(stale) > 0 {
+		// Best effort: a miss is all a lost race costs
+		c.unlink(ctx, stale)
+	}
+	return records, nil
+}
+
+// RedisTaggedCache implements TaggedCache for the Redis cache. Values
+// written through the view carry a header stamping the version of each
+// tag, and are read as missing once any of those tags is flushed, which
+// increments its version. Flushed values are then unlinked using the set
+// of keys written under the old version, so a flush costs one round trip
+// per tag plus the tag's size, and never scans the keyspace.
+//
+// Tagged values keep their keys and stay readable through the untagged
+// cache, but are not raw integers: Increment them through a tagged view.
+type RedisTaggedCache struct {
+	cache *RedisCache
+	tags  []string
+}
+
+// carries reports whether stamps cover all of the view's tags
+func (t *RedisTaggedCache) carries(stamps []stamp) bool {
+	for _, tag := range t.tags {
+		key := t.cache.tagKey(tag)
+		found := false
+		for _, s := range stamps {
+			if s.tag == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *RedisTaggedCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return t.getTyped(ctx, key, nil)
+}
+
+func (t *RedisTaggedCache) getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error) {
+	results, err := t.cache.read(ctx, []string{key}, target, false)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[key]
+	if !ok || !t.carries(result.stamps) {
+		return nil, ErrKeyNotFound
+	}
+	return result.value, nil
+}
+
+func (t *RedisTaggedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return t.SetMany(ctx, map[string]interface{}{key: value}, ttl)
+}
+
+func (t *RedisTaggedCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	ttl = t.cache.options.ttl(ttl)
+	stamps, err := t.cache.stamps(ctx, t.tags)
+	if err != nil {
+		return t.cache.stats.fail(&CacheError{Op: "set", Key: "*", Err: err})
+	}
+
+	pipe := t.cache.client.TxPipeline()
+	for key, value := range items {
+		prefixed := t.cache.prefixKey(key)
+		data, err := t.cache.serialize(value)
+		if err != nil {
+			return t.cache.stats.fail(&CacheError{Op: "serialize", Key: prefixed, Err: err})
+		}
+		pipe.Set(ctx, prefixed, wrapTagged(stamps, data), ttl)
+		if t.cache.options.tracksFreshness() {
+			pipe.Del(ctx, t.cache.freshKey(key))
+		}
+		t.cache.index(ctx, pipe, prefixed, stamps, ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return t.cache.stats.fail(&CacheError{Op: "set", Key: "*", Err: err})
+	}
+	t.cache.stats.sets.Add(uint64(len(items)))
+	return nil
+}
+
+func (t *RedisTaggedCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	results, err := t.cache.read(ctx, keys, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, len(results))
+	for key, result := range results {
+		if t.carries(result.stamps) {
+			values[key] = result.value
+		}
+	}
+	return values, nil
+}
+
+func (t *RedisTaggedCache) Delete(ctx context.Context, key string) error {
+	tagged, err := t.tagged(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	if len(tagged) == 0 {
+		return ErrKeyNotFound
+	}
+	return t.cache.DeleteMany(ctx, tagged)
+}
+
+func (t *RedisTaggedCache) DeleteMany(ctx context.Context, keys []string) error {
+	tagged, err := t.tagged(ctx, keys)
+	if err != nil {
+		return err
+	}
+	return t.cache.DeleteMany(ctx, tagged)
+}
+
+// tagged returns the keys holding live values with all of the view's tags
+func (t *RedisTaggedCache) tagged(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = t.cache.prefixKey(key)
+	}
+	pipe := t.cache.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range prefixed {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, t.cache.stats.fail(&CacheError{Op: "get", Key: strings.Join(prefixed, ","), Err: err})
+	}
+
+	raw := make(map[string][]byte, len(keys))
+	for i, cmd := range cmds {
+		if data, err := cmd.Bytes(); err == nil {
+			raw[prefixed[i]] = data
+		}
+	}
+	records, err := t.cache.open(ctx, raw)
+	if err != nil {
+		return nil, t.cache.stats.fail(&CacheError{Op: "get", Key: strings.Join(prefixed, ","), Err: err})
+	}
+
+	var tagged []string
+	for i, key := range keys {
+		if rec, ok := records[prefixed[i]]; ok && t.carries(rec.stamps) {
+			tagged = append(tagged, key)
+		}
+	}
+	return tagged, nil
+}
+
+// Clear removes every value carrying any of the view's tags, or everything
+// under the prefix for a view without tags
+func (t *RedisTaggedCache) Clear(ctx context.Context) error {
+	if len(t.tags) == 0 {
+		return t.cache.Clear(ctx)
+	}
+
+	// Incrementing the versions invalidates the tagged values at once
+	pipe := t.cache.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(t.tags))
+	for i, tag := range t.tags {
+		cmds[i] = pipe.Incr(ctx, t.cache.tagKey(tag))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return t.cache.stats.fail(&CacheError{Op: "flush", Key: strings.Join(t.tags, ","), Err: err})
+	}
+
+	for i, tag := range t.tags {
+		old := stamp{tag: t.cache.tagKey(tag), version: cmds[i].Val() - 1}
+		if err := t.cache.sweep(ctx, old); err != nil {
+			return t.cache.stats.fail(&CacheError{Op: "flush", Key: tag, Err: err})
+		}
+	}
+	return nil
+}
+
+// sweep unlinks the values written under a flushed tag version, in
+// batches. Keys rewritten since without that stamp are kept.
+func (c *RedisCache) sweep(ctx context.Context, old stamp) error {
+	members := membersKey(old)
+	iter := c.client.SScan(ctx, members, 0, "", clearBatchSize).Iterator()
+	batch := make([]string, 0, clearBatchSize)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == clearBatchSize {
+			if err := c.unlinkStamped(ctx, batch, old); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if err := c.unlinkStamped(ctx, batch, old); err != nil {
+		return err
+	}
+	return c.client.Unlink(ctx, members).Err()
+}
+
+// unlinkStamped unlinks those of the prefixed keys whose value carries the
+// stamp
+func (c *RedisCache) unlinkStamped(ctx context.Context, keys []string, old stamp) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	var stale []string
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+		stamps, _, err := unwrapTagged(data)
+		if err != nil {
+			continue
+		}
+		for _, s := range stamps {
+			if s == old {
+				stale = append(stale, keys[i])
+				break
+			}
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return c.unlink(ctx, stale)
+}
+
+// Flush removes every value carrying any of the view's tags
+func (t *RedisTaggedCache) Flush(ctx context.Context) error {
+	return t.Clear(ctx)
+}
+
+// Increment adds value to an integer written through a tagged view,
+// keeping its tags and TTL. The key must exist and carry the view's tags.
+func (t *RedisTaggedCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
+	if len(t.tags) == 0 {
+		return t.cache.Increment(ctx, key, value)
+	}
+
+	prefixed := t.cache.prefixKey(key)
+	var result int64
+	err := t.cache.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, prefixed).Bytes()
+		if err == redis.Nil {
+			return ErrKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		records, err := t.cache.open(ctx, map[string][]byte{prefixed: data})
+		if err != nil {
+			return err
+		}
+		rec, ok := records[prefixed]
+		if !ok || !t.carries(rec.stamps) {
+			return ErrKeyNotFound
+		}
+		current, err := strconv.ParseInt(string(rec.data), 10, 64)
+		if err != nil {
+			return errors.New("value is not an integer")
+		}
+
+		result = current + value
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, prefixed, wrapTagged(rec.stamps, []byte(strconv.FormatInt(result, 10))), redis.KeepTTL)
+			return nil
+		})
+		return err
+	}, prefixed)
+
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, t.cache.stats.fail(&CacheError{Op: "increment", Key: prefixed, Err: err})
+	}
+	return result, nil
+}
+
+func (t *RedisTaggedCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	return t.Increment(ctx, key, -value)
+}
+
+func (t *RedisTaggedCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
+	return t.rememberTyped(ctx, key, ttl, callback, nil)
+}
+
+func (t *RedisTaggedCache) rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	return remember(ctx, t, t.cache.loads, t.cache.options, t.cache.prefixKey(key), key, ttl, callback, target)
+}
+
+func (t *RedisTaggedCache) lookupEntry(ctx context.Context, key string, target func() interface{}) (entry, error) {
+	e, stamps, err := t.cache.lookup(ctx, key, target)
+	if err != nil || !e.found || !t.carries(stamps) {
+		return entry{}, err
+	}
+	return e, nil
+}
+
+func (t *RedisTaggedCache) storeEntry(ctx context.Context, key string, value interface{}, ttl, delta time.Duration) error {
+	return t.cache.storeRemembered(ctx, key, value, ttl, delta, t.tags)
+}
+
+func (t *RedisTaggedCache) Tags(tags ...string) TaggedCache {
+	return &RedisTaggedCache{
+		cache: t.cache,
+		tags:  append(append([]string(nil), t.tags...), tags...),
+	}
+}
+
+// WithPrefix returns a view with the same tags, nested under prefix. Tags
+// are namespaced by prefix, so flushing one prefix's tag leaves another's
+// alone.
+func (t *RedisTaggedCache) WithPrefix(prefix string) Cache {
+	return t.cache.WithPrefix(prefix).Tags(t.tags...)
+}
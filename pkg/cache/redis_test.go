@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedisCache(t *testing.T, prefix string) (*RedisCache, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache(Options{Prefix: prefix}, &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	return c, mr
+}
+
+func TestRedisCache(t *testing.T) {
+	c, mr := newTestRedisCache(t, "app")
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "user:1", "ada", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if !mr.Exists("app:user:1") {
+		t.Error("Set() did not write the prefixed key")
+	}
+
+	if err := c.SetMany(ctx, map[string]interface{}{"a": "1", "b": "2"}, 0); err != nil {
+		t.Fatalf("SetMany() error = %v", err)
+	}
+	got, err := c.GetMany(ctx, []string{"a", "b", "missing"})
+	if err != nil || len(got) != 2 || got["a"] != "1" || got["b"] != "2" {
+		t.Errorf("GetMany() = %v, %v", got, err)
+	}
+
+	if err := c.DeleteMany(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get() after DeleteMany error = %v, want ErrKeyNotFound", err)
+	}
+
+	if n, err := c.Increment(ctx, "hits", 5); err != nil || n != 5 {
+		t.Errorf("Increment() = %d, %v, want 5", n, err)
+	}
+	if n, err := c.Decrement(ctx, "hits", 2); err != nil || n != 3 {
+		t.Errorf("Decrement() = %d, %v, want 3", n, err)
+	}
+
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return "computed", nil
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := c.Remember(ctx, "report", time.Minute, fn); err != nil || v != "computed" {
+			t.Fatalf("Remember() = %v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Remember() called the callback %d times, want 1", calls)
+	}
+}
+
+func TestRedisCache_ClearScopedToPrefix(t *testing.T) {
+	c, mr := newTestRedisCache(t, "app")
+	ctx := context.Background()
+
+	mr.Set("other:key", "kept")
+	sessions := c.WithPrefix("sessions")
+	sessions.Set(ctx, "s1", "x", 0)
+	c.Set(ctx, "user:1", "ada", 0)
+
+	if !mr.Exists("app:sessions:s1") {
+		t.Fatal("WithPrefix() did not nest the prefix")
+	}
+
+	// Clearing the view leaves the parent's keys alone
+	if err := sessions.Clear(ctx); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if mr.Exists("app:sessions:s1") || !mr.Exists("app:user:1") {
+		t.Errorf("view Clear() keys = %v, want only app:user:1 and other:key", mr.Keys())
+	}
+
+	if err := c.Clear(ctx); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "other:key" {
+		t.Errorf("keys after Clear() = %v, want [other:key]", keys)
+	}
+}
+
+func TestRedisCache_ClearWithoutPrefix(t *testing.T) {
+	c, mr := newTestRedisCache(t, "")
+	ctx := context.Background()
+
+	mr.Set("jobs:queue", "pending")
+	mr.Set("lock:report", "held")
+	c.Set(ctx, "user:1", "ada", 0)
+
+	if err := c.Clear(ctx); !errors.Is(err, ErrNoPrefix) {
+		t.Errorf("Clear() error = %v, want ErrNoPrefix", err)
+	}
+	if err := c.Tags().Clear(ctx); !errors.Is(err, ErrNoPrefix) {
+		t.Errorf("untagged view Clear() error = %v, want ErrNoPrefix", err)
+	}
+	tiered := NewTieredCache(NewMemoryCache(Options{}), c, TieredOptions{})
+	if err := tiered.Clear(ctx); !errors.Is(err, ErrNoPrefix) {
+		t.Errorf("TieredCache.Clear() error = %v, want ErrNoPrefix", err)
+	}
+	if err := tiered.Tags().Clear(ctx); !errors.Is(err, ErrNoPrefix) {
+		t.Errorf("TieredTaggedCache.Clear() error = %v, want ErrNoPrefix", err)
+	}
+
+	for _, key := range []string{"jobs:queue", "lock:report", "user:1"} {
+		if !mr.Exists(key) {
+			t.Errorf("%s was removed", key)
+		}
+	}
+}
+
+func TestRedisCache_Tags(t *testing.T) {
+	c, _ := newTestRedisCache(t, "app")
+	ctx := context.Background()
+
+	c.Tags("users").Set(ctx, "user:1", "ada", 0)
+	c.Tags("users", "admins").Set(ctx, "user:2", "grace", 0)
+	c.Set(ctx, "plain", "x", 0)
+
+	admins := c.Tags("admins")
+	if _, err := admins.Get(ctx, "user:1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get() of untagged key error = %v, want ErrKeyNotFound", err)
+	}
+	if v, err := admins.Get(ctx, "user:2"); err != nil || v != "grace" {
+		t.Errorf("Get() = %v, %v, want grace", v, err)
+	}
+
+	if err := c.Tags("users").Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	for _, key := range []string{"user:1", "user:2"} {
+		if _, err := c.Get(ctx, key); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Get(%s) after Flush() error = %v, want ErrKeyNotFound", key, err)
+		}
+	}
+	if _, err := c.Get(ctx, "plain"); err != nil {
+		t.Errorf("Get(plain) after Flush() error = %v", err)
+	}
+}
+
+func TestRedisCache_RememberStale(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache(Options{Prefix: "app", StaleWhileRevalidate: time.Minute}, &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	ctx := context.Background()
+
+	c.Remember(ctx, "report", 10*time.Millisecond, func() (interface{}, error) { return "old", nil })
+	if !mr.Exists("app:__fresh:report") {
+		t.Fatal("Remember() did not write the freshness marker")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	refreshed := make(chan struct{})
+	v, err := c.Remember(ctx, "report", time.Minute, func() (interface{}, error) {
+		defer close(refreshed)
+		return "new", nil
+	})
+	if err != nil || v != "old" {
+		t.Errorf("Remember() = %v, %v, want the stale value", v, err)
+	}
+
+	<-refreshed
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := c.Get(ctx, "report"); v != "new" {
+		t.Errorf("Get() after refresh = %v, want new", v)
+	}
+
+	// A plain write drops the marker, so the value counts as fresh
+	c.Set(ctx, "report", "manual", 0)
+	if mr.Exists("app:__fresh:report") {
+		t.Error("Set() left the freshness marker behind")
+	}
+}
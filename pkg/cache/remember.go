@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// entry is what Remember found for a key
+type entry struct {
+	value interface{}
+	found bool
+	// expires is when the value turns stale; zero if it never does
+	expires time.Time
+	// delta is how long the loader took to compute the value
+	delta time.Duration
+}
+
+// rememberer is a cache that keeps the freshness metadata Remember needs
+// alongside its values
+type rememberer interface {
+	// lookupEntry decodes a stored value into target, for caches that
+	// encode values, or into interface{} when target is nil
+	lookupEntry(ctx context.Context, key string, target func() interface{}) (entry, error)
+	storeEntry(ctx context.Context, key string, value interface{}, ttl, delta time.Duration) error
+}
+
+// tracksFreshness reports whether any mode needing freshness metadata is on
+func (o Options) tracksFreshness() bool {
+	return o.StaleWhileRevalidate > 0 || o.StaleIfError > 0 || o.EarlyExpiration > 0
+}
+
+// ttl returns the lifetime of a value written with ttl, applying
+// DefaultTTL when it is zero
+func (o Options) ttl(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return o.DefaultTTL
+	}
+	return ttl
+}
+
+// retention is how long a value written by Remember is kept: its ttl plus
+// the longest stale window
+func (o Options) retention(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	return ttl + max(o.StaleWhileRevalidate, o.StaleIfError)
+}
+
+// outcomeKey is the context key of the *outcome a Remember call records
+// for InstrumentedCache
+type outcomeKey struct{}
+
+// outcome records how remember answered: handled is set when remember ran,
+// and waited when the caller waited on a loader instead of getting a
+// cached value
+type outcome struct {
+	handled atomic.Bool
+	waited  atomic.Bool
+}
+
+// recordOutcome returns the outcome carried by ctx, or nil
+func recordOutcome(ctx context.Context) *outcome {
+	o, _ := ctx.Value(outcomeKey{}).(*outcome)
+	return o
+}
+
+// remember implements Remember with stampede protection. Concurrent misses
+// for a key share one loader call through loads, keyed by id. Stale values
+// are served while a background refresh runs, or when a refresh fails,
+// within the windows set in opts.
+func remember(ctx context.Context, r rememberer, loads *flight, opts Options, id, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	ttl = opts.ttl(ttl)
+	o := recordOutcome(ctx)
+	if o != nil {
+		o.handled.Store(true)
+	}
+	e, err := r.lookupEntry(ctx, key, target)
+	if err != nil {
+		return nil, err
+	}
+
+	load := func() (interface{}, error) {
+		start := time.Now()
+		value, err := callback()
+		if err != nil {
+			return nil, err
+		}
+		// A background refresh outlives the caller that started it
+		if err := r.storeEntry(context.WithoutCancel(ctx), key, value, ttl, time.Since(start)); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	// wait loads the value for the caller, who gets no cached value
+	wait := func() (interface{}, error) {
+		if o != nil {
+			o.waited.Store(true)
+		}
+		return loads.do(ctx, id, load)
+	}
+
+	if !e.found {
+		return wait()
+	}
+	if e.expires.IsZero() {
+		return e.value, nil
+	}
+
+	// age is how long the value has been stale, negative while fresh
+	age := time.Since(e.expires)
+	switch {
+	case age < 0:
+		if refreshEarly(-age, e.delta, opts.EarlyExpiration) {
+			loads.start(id, load)
+		}
+		return e.value, nil
+	case age <= opts.StaleWhileRevalidate:
+		loads.start(id, load)
+		return e.value, nil
+	}
+
+	value, err := wait()
+	if err != nil && age <= opts.StaleIfError {
+		return e.value, nil
+	}
+	return value, err
+}
+
+// refreshEarly decides whether to refresh a fresh value ahead of its expiry
+// (XFetch). The chance rises as the remaining time shrinks and for values
+// that were slow to compute.
+func refreshEarly(remaining, delta time.Duration, beta float64) bool {
+	if beta <= 0 || delta <= 0 {
+		return false
+	}
+	return -float64(delta)*beta*math.Log(rand.Float64()) >= float64(remaining)
+}
+
+// flight de-duplicates concurrent loads of the same key. The zero value is
+// ready to use.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// do runs fn for key, or waits for the run already in progress
+func (f *flight) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	c, leader := f.join(key)
+	if leader {
+		f.run(key, c, fn)
+		return c.value, c.err
+	}
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start runs fn for key in the background unless a run is in progress
+func (f *flight) start(key string, fn func() (interface{}, error)) {
+	c, leader := f.join(key)
+	if !leader {
+		return
+	}
+
+	go func() {
+		f.run(key, c, fn)
+		if c.err != nil {
+			log.Printf("cache: failed to refresh %s: %v", key, c.err)
+		}
+	}()
+}
+
+func (f *flight) join(key string) (*call, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c, ok := f.calls[key]; ok {
+		return c, false
+	}
+	if f.calls == nil {
+		f.calls = make(map[string]*call)
+	}
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	return c, true
+}
+
+func (f *flight) run(key string, c *call, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("cache loader panicked: %v", r)
+		}
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// minShardEntries and minShardMemory keep bounded caches from being
+	// split into shards too small for the eviction policy to be useful
+	minShardEntries = 64
+	minShardMemory  = 1 << 20
+
+	// expireBatch bounds the expired entries a shard removes per cleanup
+	// pass, so no pass holds a shard's lock for long
+	expireBatch = 256
+)
+
+// shard is one lock-striped partition of a MemoryCache, with its own share
+// of the entry and memory limits
+type shard struct {
+	mu        sync.Mutex
+	cache     *MemoryCache
+	items     map[string]*Item
+	tags      map[string]map[string]struct{} // tag to the keys carrying it
+	expiry    expiryHeap
+	policy    policy
+	maxItems  int
+	maxMemory int64
+	memory    int64
+
+	hits        uint64
+	misses      uint64
+	sets        uint64
+	errors      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// shardCount picks a power-of-two shard count from Options.Shards, reduced
+// so that bounded caches keep reasonably large shards
+func shardCount(opts Options) int {
+	n := opts.Shards
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	if opts.MaxEntries > 0 {
+		n = min(n, max(opts.MaxEntries/minShardEntries, 1))
+	}
+	if opts.MaxMemory > 0 {
+		n = min(n, max(int(opts.MaxMemory/minShardMemory), 1))
+	}
+
+	count := 1
+	for count*2 <= n {
+		count *= 2
+	}
+	return count
+}
+
+func newShard(c *MemoryCache, count int) *shard {
+	s := &shard{
+		cache:     c,
+		maxItems:  c.options.MaxEntries / count,
+		maxMemory: c.options.MaxMemory / int64(count),
+	}
+	s.reset()
+	return s
+}
+
+// shard returns the shard holding key, chosen by its FNV-1a hash
+func (c *MemoryCache) shard(key string) *shard {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return c.shards[hash&c.mask]
+}
+
+// reset empties the shard. Callers hold s.mu.
+func (s *shard) reset() {
+	s.items = make(map[string]*Item)
+	s.tags = make(map[string]map[string]struct{})
+	s.expiry = nil
+	s.policy = newPolicy(s.cache.options.Eviction, s.maxItems)
+	s.memory = 0
+}
+
+// lookup returns a live item and records the hit or miss. An expired item is
+// removed and reported as ErrKeyExpired. Callers hold s.mu.
+func (s *shard) lookup(key string) (*Item, error) {
+	item, found := s.items[key]
+	if !found {
+		s.misses++
+		return nil, ErrKeyNotFound
+	}
+
+	if item.expired(time.Now().UnixNano()) {
+		s.remove(key)
+		s.expirations++
+		s.misses++
+		return nil, ErrKeyExpired
+	}
+
+	s.policy.access(key)
+	s.hits++
+	return item, nil
+}
+
+// store inserts or replaces an item, first evicting entries chosen by the
+// policy while the shard is over its entry or memory limit. Callers hold
+// s.mu.
+func (s *shard) store(key string, item *Item) error {
+	item.key = key
+	item.index = -1
+	item.size = s.cache.sizeOf(key, item.Value)
+	if s.maxMemory > 0 && item.size > s.maxMemory {
+		s.errors++
+		return ErrValueTooLarge
+	}
+
+	// A replaced entry's memory is released before making room, while the
+	// policy keeps its history
+	if old, exists := s.items[key]; exists {
+		s.unlink(old)
+	}
+
+	for s.overLimit(item.size) {
+		if !s.evict() {
+			break
+		}
+	}
+
+	s.items[key] = item
+	s.memory += item.size
+	for _, tag := range item.Tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	if item.Expiration > 0 {
+		heap.Push(&s.expiry, item)
+	}
+	s.policy.add(key)
+	s.sets++
+	return nil
+}
+
+// overLimit reports whether adding an entry of size would exceed a limit
+func (s *shard) overLimit(size int64) bool {
+	if s.maxItems > 0 && len(s.items) >= s.maxItems {
+		return true
+	}
+	return s.maxMemory > 0 && s.memory+size > s.maxMemory
+}
+
+// remove deletes an item. Callers hold s.mu.
+func (s *shard) remove(key string) {
+	if item, found := s.items[key]; found {
+		s.unlink(item)
+		s.policy.remove(key)
+	}
+}
+
+// unlink drops an item from the map, the tag index and the expiry heap,
+// leaving the policy alone
+func (s *shard) unlink(item *Item) {
+	delete(s.items, item.key)
+	s.memory -= item.size
+	for _, tag := range item.Tags {
+		if keys, ok := s.tags[tag]; ok {
+			delete(keys, item.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+	if item.index >= 0 {
+		heap.Remove(&s.expiry, item.index)
+	}
+}
+
+// flush removes the items carrying any of tags. Callers hold s.mu.
+func (s *shard) flush(tags []string) {
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			s.remove(key)
+		}
+	}
+}
+
+// evict removes the policy's victim and reports it to Options.OnEvict.
+// Callers hold s.mu.
+func (s *shard) evict() bool {
+	key, ok := s.policy.victim()
+	if !ok {
+		return false
+	}
+
+	// The victim may be an entry being replaced, already unlinked
+	item, found := s.items[key]
+	if !found {
+		return true
+	}
+	s.unlink(item)
+	s.evictions++
+	if onEvict := s.cache.options.OnEvict; onEvict != nil {
+		onEvict(key, item.Value)
+	}
+	return true
+}
+
+// expire removes up to expireBatch items expired at now, soonest first
+func (s *shard) expire(now int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n := 0; n < expireBatch && len(s.expiry) > 0 && s.expiry[0].expired(now); n++ {
+		s.remove(s.expiry[0].key)
+		s.expirations++
+	}
+}
+
+// expiryHeap is a min-heap of a shard's expiring items, soonest first
+type expiryHeap []*Item
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].Expiration < h[j].Expiration }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	item := x.(*Item)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"errors"
+)
+
+// ErrValueTooLarge is returned when a single entry exceeds Options.MaxMemory
+var ErrValueTooLarge = errors.New("value is larger than the cache's memory limit")
+
+// entryOverhead approximates the bookkeeping cost of an entry: the map
+// slot, the Item and the eviction policy's list element
+const entryOverhead = 64
+
+// Sizer is implemented by values that report their own size in bytes, for
+// caches bounded by Options.MaxMemory
+type Sizer interface {
+	Size() int64
+}
+
+// sizeOf estimates the memory held by an entry. Sizers report their own
+// size, strings and byte slices are measured directly, and other values by
+// their serialized length using Options.SerializeFunc, or the codec.
+func (c *MemoryCache) sizeOf(key string, value interface{}) int64 {
+	size := int64(len(key)) + entryOverhead
+
+	switch v := value.(type) {
+	case Sizer:
+		return size + v.Size()
+	case []byte:
+		return size + int64(len(v))
+	case string:
+		return size + int64(len(v))
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return size + 8
+	}
+
+	serialize := c.options.SerializeFunc
+	if serialize == nil {
+		serialize = c.options.codec().Marshal
+	}
+	if data, err := serialize(value); err == nil {
+		return size + int64(len(data))
+	}
+	return size + entryOverhead
+}
@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	redisCache, _ := newTestRedisCache(t, "app")
+	backends := map[string]Cache{
+		"memory": NewMemoryCache(Options{}),
+		"redis":  redisCache,
+	}
+
+	for name, c := range backends {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			merchant := c.WithPrefix("shop").Tags("merchant:42")
+			merchant.Set(ctx, "order:1", "a", time.Minute)
+			merchant.Tags("vip").Set(ctx, "order:2", "b", 0)
+			c.WithPrefix("shop").Set(ctx, "order:3", "c", 0)
+			// The same tag under another prefix is another tag
+			other := c.WithPrefix("other").Tags("merchant:42")
+			other.Set(ctx, "order:1", "d", 0)
+
+			if v, err := merchant.Get(ctx, "order:2"); err != nil || v != "b" {
+				t.Errorf("Get(order:2) = %v, %v, want b", v, err)
+			}
+			if _, err := merchant.Get(ctx, "order:3"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Get() of an untagged key error = %v, want ErrKeyNotFound", err)
+			}
+
+			// Flushing the narrower view still removes every entry with
+			// any of its tags
+			if err := merchant.Tags("vip").Flush(ctx); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+			for key, want := range map[string]bool{"order:1": false, "order:2": false, "order:3": true} {
+				if _, err := c.WithPrefix("shop").Get(ctx, key); (err == nil) != want {
+					t.Errorf("Get(%s) after Flush() error = %v, want present = %v", key, err, want)
+				}
+			}
+			if v, err := other.Get(ctx, "order:1"); err != nil || v != "d" {
+				t.Errorf("Get() under another prefix = %v, %v, want d", v, err)
+			}
+
+			// Tagging again after a flush works, and a tagged view keeps
+			// its tags under a further prefix
+			merchant.Set(ctx, "order:1", "e", 0)
+			if v, err := merchant.Get(ctx, "order:1"); err != nil || v != "e" {
+				t.Errorf("Get() after rewriting = %v, %v, want e", v, err)
+			}
+			nested := merchant.WithPrefix("eu")
+			if _, ok := nested.(TaggedCache); !ok {
+				t.Fatalf("WithPrefix() on a tagged view = %T, want a TaggedCache", nested)
+			}
+			nested.Set(ctx, "order:9", "f", 0)
+			if _, err := c.WithPrefix("shop").Get(ctx, "order:9"); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Get() outside the nested prefix error = %v, want ErrKeyNotFound", err)
+			}
+			if v, err := c.WithPrefix("shop").WithPrefix("eu").Get(ctx, "order:9"); err != nil || v != "f" {
+				t.Errorf("Get() in the nested prefix = %v, %v, want f", v, err)
+			}
+		})
+	}
+}
+
+func TestMemoryCache_TagIndex(t *testing.T) {
+	c := NewMemoryCache(Options{Shards: 4})
+	ctx := context.Background()
+	users := c.Tags("users")
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		users.Set(ctx, key, key, 0)
+	}
+	users.Set(ctx, "a", "replaced", 0)
+	c.Set(ctx, "b", "untagged", 0)
+	c.Delete(ctx, "c")
+
+	indexed := 0
+	for _, s := range c.shards {
+		indexed += len(s.tags["users"])
+	}
+	if indexed != 3 {
+		t.Errorf("index holds %d keys, want 3", indexed)
+	}
+
+	users.Flush(ctx)
+	if stats := c.Stats(); stats.Entries != 1 {
+		t.Errorf("Stats() after Flush() = %+v, want only the untagged entry", stats)
+	}
+	for _, s := range c.shards {
+		if len(s.tags) != 0 {
+			t.Errorf("index after Flush() = %v, want empty", s.tags)
+		}
+	}
+
+	if prefixed := c.WithPrefix("p"); c.options.Prefix != "" || prefixed.(*MemoryCache).options.Prefix != "p" {
+		t.Error("WithPrefix() changed the parent's prefix")
+	}
+}
+
+func TestRedisTaggedCache_Flush(t *testing.T) {
+	c, mr := newTestRedisCache(t, "app")
+	ctx := context.Background()
+	users := c.Tags("users")
+
+	users.Set(ctx, "user:1", "ada", 0)
+	users.Set(ctx, "user:2", "grace", 0)
+	users.Set(ctx, "visits", 1, 0)
+	// Rewritten without the tag, so the flush keeps it
+	c.Set(ctx, "user:2", "linus", 0)
+
+	if n, err := users.Increment(ctx, "visits", 2); err != nil || n != 3 {
+		t.Errorf("Increment() = %d, %v, want 3", n, err)
+	}
+	if _, err := users.Increment(ctx, "missing", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Increment() of a missing key error = %v, want ErrKeyNotFound", err)
+	}
+
+	if err := users.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	for key, want := range map[string]bool{"app:user:1": false, "app:visits": false, "app:user:2": true, "app:__tags:users:0": false} {
+		if mr.Exists(key) != want {
+			t.Errorf("%s exists = %v, want %v", key, !want, want)
+		}
+	}
+	if v, _ := mr.Get("app:__tags:users"); v != "1" {
+		t.Errorf("tag version = %q, want 1", v)
+	}
+
+	// A value stamped with a flushed version is dropped on read, even if
+	// the sweep missed it
+	stale := wrapTagged([]stamp{{tag: c.tagKey("users"), version: 0}}, []byte(`"old"`))
+	mr.Set("app:user:3", string(stale))
+	if _, err := c.Get(ctx, "user:3"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get() of a stale value error = %v, want ErrKeyNotFound", err)
+	}
+	if mr.Exists("app:user:3") {
+		t.Error("stale value was not unlinked")
+	}
+}
+
+func TestMemoryCache_ConcurrentFlush(t *testing.T) {
+	c := NewMemoryCache(Options{})
+	ctx := context.Background()
+	users := c.Tags("users")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			users.Set(ctx, "user", i, 0)
+			users.Get(ctx, "user")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		users.Flush(ctx)
+	}
+	<-done
+
+	users.Flush(ctx)
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats() after Flush() = %+v, want no entries", stats)
+	}
+}
+
+func TestRedisTaggedCache_MembersExpire(t *testing.T) {
+	c, mr := newTestRedisCache(t, "app")
+	ctx := context.Background()
+
+	sessions := c.Tags("sessions")
+	sessions.Set(ctx, "s:1", "a", time.Minute)
+	sessions.Set(ctx, "s:2", "b", 5*time.Minute)
+	sessions.Set(ctx, "s:3", "c", 2*time.Minute)
+	if ttl := mr.TTL("app:__tags:sessions:0"); ttl != 5*time.Minute {
+		t.Errorf("member set TTL = %v, want the longest value TTL 5m", ttl)
+	}
+
+	mr.FastForward(6 * time.Minute)
+	if mr.Exists("app:__tags:sessions:0") {
+		t.Error("member set outlived its values")
+	}
+
+	// A value without expiry keeps the set
+	settings := c.Tags("settings")
+	settings.Set(ctx, "theme", "dark", time.Minute)
+	settings.Set(ctx, "locale", "en", 0)
+	settings.Set(ctx, "font", "serif", time.Minute)
+	if ttl := mr.TTL("app:__tags:settings:0"); ttl != 0 {
+		t.Errorf("member set TTL = %v, want none while it indexes a persistent value", ttl)
+	}
+}
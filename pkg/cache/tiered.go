@@ -0,0 +1,406 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+var _ Cache = (*TieredCache)(nil)
+
+// TieredOptions configures a TieredCache
+type TieredOptions struct {
+	// L1TTL caps how long a value stays in the local tier, which bounds
+	// how stale it can get if an invalidation is lost. Defaults to a
+	// minute.
+	L1TTL time.Duration
+
+	// Channel is the pub/sub channel invalidations are broadcast on.
+	// Defaults to "__invalidate" under the L2 prefix.
+	Channel string
+}
+
+// TieredCache layers a local MemoryCache (L1) in front of a shared
+// RedisCache (L2). Reads try L1, then L2, copying hits into L1; writes go
+// to both. Every write and delete is broadcast over Redis pub/sub so that
+// other replicas drop their L1 copies, which requires Run.
+type TieredCache struct {
+	l1      *MemoryCache
+	l2      *RedisCache
+	options TieredOptions
+	node    string
+}
+
+// invalidation is the pub/sub message telling replicas to drop L1 copies
+type invalidation struct {
+	Node string `json:"node"`
+	// Keys are full L2 keys; none means clear the whole L1
+	Keys []string `json:"keys,omitempty"`
+}
+
+// NewTieredCache creates a two-tier cache. The L1 cache should not be
+// used directly, since its keys are the L2's prefixed keys.
+func NewTieredCache(l1 *MemoryCache, l2 *RedisCache, opts TieredOptions) *TieredCache {
+	if opts.L1TTL <= 0 {
+		opts.L1TTL = time.Minute
+	}
+	if opts.Channel == "" {
+		opts.Channel = l2.prefixKey("__invalidate")
+	}
+
+	node := make([]byte, 8)
+	if _, err := rand.Read(node); err != nil {
+		panic(err)
+	}
+
+	return &TieredCache{
+		l1:      l1,
+		l2:      l2,
+		options: opts,
+		node:    hex.EncodeToString(node),
+	}
+}
+
+// Run applies invalidations broadcast by other replicas until ctx is done.
+// Messages published while the subscription is down are lost; L1TTL
+// bounds the staleness that can cause.
+func (c *TieredCache) Run(ctx context.Context) error {
+	sub := c.l2.client.Subscribe(ctx, c.options.Channel)
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", c.options.Channel, err)
+	}
+	// Anything published before the subscription started was missed
+	c.l1.Clear(ctx)
+
+	messages := sub.Channel()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				log.Printf("cache: ignoring invalid invalidation message: %v", err)
+				continue
+			}
+			if inv.Node == c.node {
+				continue
+			}
+			if len(inv.Keys) == 0 {
+				c.l1.Clear(ctx)
+			} else {
+				c.l1.DeleteMany(ctx, inv.Keys)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return c.getTyped(ctx, key, nil)
+}
+
+// getTyped skips L1 copies of another type than target's, such as maps
+// backfilled by an untyped Get
+func (c *TieredCache) getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error) {
+	if value, err := c.l1.Get(ctx, c.l2.prefixKey(key)); err == nil && fits(value, target) {
+		return value, nil
+	}
+
+	values, ttls, err := c.l2.fetch(ctx, []string{key}, target)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	c.l1.Set(ctx, c.l2.prefixKey(key), value, c.l1TTL(ttls[key]))
+	return value, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := c.l2.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	c.l1.Set(ctx, c.l2.prefixKey(key), value, c.l1TTL(ttl))
+	return c.invalidate(ctx, key)
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	if err := c.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+	c.l1.Delete(ctx, c.l2.prefixKey(key))
+	return c.invalidate(ctx, key)
+}
+
+// Clear removes the L2 keys under the cache's prefix, and the whole L1 on
+// every replica. Like RedisCache.Clear, it needs a prefix.
+func (c *TieredCache) Clear(ctx context.Context) error {
+	if err := c.l2.Clear(ctx); err != nil {
+		return err
+	}
+	c.l1.Clear(ctx)
+	return c.invalidate(ctx)
+}
+
+func (c *TieredCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	results := make(map[string]interface{}, len(keys))
+	missing := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value, err := c.l1.Get(ctx, c.l2.prefixKey(key)); err == nil {
+			results[key] = value
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	values, ttls, err := c.l2.fetch(ctx, missing, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		results[key] = value
+		c.l1.Set(ctx, c.l2.prefixKey(key), value, c.l1TTL(ttls[key]))
+	}
+	return results, nil
+}
+
+func (c *TieredCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	if err := c.l2.SetMany(ctx, items, ttl); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(items))
+	for key, value := range items {
+		c.l1.Set(ctx, c.l2.prefixKey(key), value, c.l1TTL(ttl))
+		keys = append(keys, key)
+	}
+	return c.invalidate(ctx, keys...)
+}
+
+func (c *TieredCache) DeleteMany(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := c.l2.DeleteMany(ctx, keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.l1.Delete(ctx, c.l2.prefixKey(key))
+	}
+	return c.invalidate(ctx, keys...)
+}
+
+// Remember returns the value from L1, or from the L2's Remember, which
+// de-duplicates loads and applies its stale modes
+func (c *TieredCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
+	return c.rememberTyped(ctx, key, ttl, callback, nil)
+}
+
+func (c *TieredCache) rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	if value, err := c.l1.Get(ctx, c.l2.prefixKey(key)); err == nil && fits(value, target) {
+		return value, nil
+	}
+
+	value, err := c.l2.rememberTyped(ctx, key, ttl, callback, target)
+	if err != nil {
+		return nil, err
+	}
+	c.l1.Set(ctx, c.l2.prefixKey(key), value, c.l1TTL(ttl))
+	return value, nil
+}
+
+func (c *TieredCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
+	result, err := c.l2.Increment(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	c.l1.Delete(ctx, c.l2.prefixKey(key))
+	return result, c.invalidate(ctx, key)
+}
+
+func (c *TieredCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	return c.Increment(ctx, key, -value)
+}
+
+// WithPrefix returns a view whose L2 keys are nested under prefix. Views
+// share the L1, keyed by full L2 key, and the invalidation channel.
+func (c *TieredCache) WithPrefix(prefix string) Cache {
+	return &TieredCache{
+		l1:      c.l1,
+		l2:      c.l2.WithPrefix(prefix).(*RedisCache),
+		options: c.options,
+		node:    c.node,
+	}
+}
+
+// Tags returns a view whose writes are tagged in L2. Tag membership lives
+// in L2 only, so the view reads from L2, and flushing clears L1 on every
+// replica.
+func (c *TieredCache) Tags(tags ...string) TaggedCache {
+	return &TieredTaggedCache{
+		cache: c,
+		l2:    c.l2.Tags(tags...).(*RedisTaggedCache),
+	}
+}
+
+// Stats combines the tiers: hits in either, misses in L2, which every L1
+// miss falls through to, and the writes and entries of L2. Errors,
+// evictions and expirations are summed.
+func (c *TieredCache) Stats() Stats {
+	l1, l2 := c.l1.Stats(), c.l2.Stats()
+	return Stats{
+		Hits:        l1.Hits + l2.Hits,
+		Misses:      l2.Misses,
+		Sets:        l2.Sets,
+		Errors:      l1.Errors + l2.Errors,
+		Evictions:   l1.Evictions + l2.Evictions,
+		Expirations: l1.Expirations + l2.Expirations,
+		Entries:     l2.Entries,
+		Memory:      l2.Memory,
+	}
+}
+
+// l1TTL is the local lifetime of a value with the given L2 TTL
+func (c *TieredCache) l1TTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > c.options.L1TTL {
+		return c.options.L1TTL
+	}
+	return ttl
+}
+
+// invalidate tells other replicas to drop keys from their L1, or all of it
+// when no keys are given
+func (c *TieredCache) invalidate(ctx context.Context, keys ...string) error {
+	inv := invalidation{Node: c.node}
+	for _, key := range keys {
+		inv.Keys = append(inv.Keys, c.l2.prefixKey(key))
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return &CacheError{Op: "invalidate", Key: c.options.Channel, Err: err}
+	}
+	if err := c.l2.client.Publish(ctx, c.options.Channel, data).Err(); err != nil {
+		return &CacheError{Op: "invalidate", Key: c.options.Channel, Err: err}
+	}
+	return nil
+}
+
+// TieredTaggedCache implements TaggedCache for the tiered cache
+type TieredTaggedCache struct {
+	cache *TieredCache
+	l2    *RedisTaggedCache
+}
+
+func (t *TieredTaggedCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return t.l2.Get(ctx, key)
+}
+
+func (t *TieredTaggedCache) getTyped(ctx context.Context, key string, target func() interface{}) (interface{}, error) {
+	return t.l2.getTyped(ctx, key, target)
+}
+
+func (t *TieredTaggedCache) GetMany(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	return t.l2.GetMany(ctx, keys)
+}
+
+func (t *TieredTaggedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := t.l2.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	return t.drop(ctx, key)
+}
+
+func (t *TieredTaggedCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	if err := t.l2.SetMany(ctx, items, ttl); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	return t.drop(ctx, keys...)
+}
+
+func (t *TieredTaggedCache) Delete(ctx context.Context, key string) error {
+	if err := t.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+	return t.drop(ctx, key)
+}
+
+func (t *TieredTaggedCache) DeleteMany(ctx context.Context, keys []string) error {
+	if err := t.l2.DeleteMany(ctx, keys); err != nil {
+		return err
+	}
+	return t.drop(ctx, keys...)
+}
+
+func (t *TieredTaggedCache) Clear(ctx context.Context) error {
+	if err := t.l2.Clear(ctx); err != nil {
+		return err
+	}
+	return t.drop(ctx)
+}
+
+func (t *TieredTaggedCache) Flush(ctx context.Context) error {
+	return t.Clear(ctx)
+}
+
+func (t *TieredTaggedCache) Remember(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error)) (interface{}, error) {
+	return t.l2.Remember(ctx, key, ttl, callback)
+}
+
+func (t *TieredTaggedCache) rememberTyped(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), target func() interface{}) (interface{}, error) {
+	return t.l2.rememberTyped(ctx, key, ttl, callback, target)
+}
+
+func (t *TieredTaggedCache) Increment(ctx context.Context, key string, value int64) (int64, error) {
+	result, err := t.l2.Increment(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	return result, t.drop(ctx, key)
+}
+
+func (t *TieredTaggedCache) Decrement(ctx context.Context, key string, value int64) (int64, error) {
+	return t.Increment(ctx, key, -value)
+}
+
+func (t *TieredTaggedCache) Tags(tags ...string) TaggedCache {
+	return &TieredTaggedCache{
+		cache: t.cache,
+		l2:    t.l2.Tags(tags...).(*RedisTaggedCache),
+	}
+}
+
+// WithPrefix returns a view with the same tags, nested under prefix
+func (t *TieredTaggedCache) WithPrefix(prefix string) Cache {
+	return t.cache.WithPrefix(prefix).Tags(t.l2.tags...)
+}
+
+// drop removes keys from L1 here and on other replicas, or all of L1 when
+// no keys are given
+func (t *TieredTaggedCache) drop(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		t.cache.l1.Clear(ctx)
+	}
+	for _, key := range keys {
+		t.cache.l1.Delete(ctx, t.cache.l2.prefixKey(key))
+	}
+	return t.cache.invalidate(ctx, keys...)
+}
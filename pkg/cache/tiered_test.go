@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestTieredCache_Invalidation(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two replicas sharing one Redis
+	replicas := make([]*TieredCache, 2)
+	for i := range replicas {
+		l2, err := NewRedisCache(Options{Prefix: "app"}, &redis.Options{Addr: mr.Addr()})
+		if err != nil {
+			t.Fatalf("NewRedisCache() error = %v", err)
+		}
+		replicas[i] = NewTieredCache(NewMemoryCache(Options{}), l2, TieredOptions{})
+		go replicas[i].Run(ctx)
+	}
+	a, b := replicas[0], replicas[1]
+	waitFor(t, func() bool { return mr.PubSubNumSub("app:__invalidate")["app:__invalidate"] == 2 })
+
+	a.Set(ctx, "user:1", "ada", time.Minute)
+	if v, err := b.Get(ctx, "user:1"); err != nil || v != "ada" {
+		t.Fatalf("Get() = %v, %v, want ada", v, err)
+	}
+	if _, err := b.l1.Get(ctx, "app:user:1"); err != nil {
+		t.Fatalf("Get() did not backfill L1: %v", err)
+	}
+
+	// A's write reaches B's L1 through the broadcast
+	a.Set(ctx, "user:1", "grace", time.Minute)
+	waitFor(t, func() bool {
+		v, _ := b.Get(ctx, "user:1")
+		return v == "grace"
+	})
+
+	a.Delete(ctx, "user:1")
+	waitFor(t, func() bool {
+		_, err := b.Get(ctx, "user:1")
+		return errors.Is(err, ErrKeyNotFound)
+	})
+
+	b.Tags("users").Set(ctx, "user:2", "linus", 0)
+	a.Get(ctx, "user:2")
+	if err := b.Tags("users").Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	waitFor(t, func() bool {
+		_, err := a.Get(ctx, "user:2")
+		return errors.Is(err, ErrKeyNotFound)
+	})
+}
+
+func TestTieredCache_L1TTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l2, err := NewRedisCache(Options{}, &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	c := NewTieredCache(NewMemoryCache(Options{}), l2, TieredOptions{L1TTL: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	l2.Set(ctx, "key", "v1", 0)
+	c.Get(ctx, "key")
+	// Changed behind the tiered cache's back, as by a missed invalidation
+	l2.Set(ctx, "key", "v2", 0)
+	if v, _ := c.Get(ctx, "key"); v != "v1" {
+		t.Errorf("Get() = %v, want the L1 copy", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if v, _ := c.Get(ctx, "key"); v != "v2" {
+		t.Errorf("Get() after L1TTL = %v, want v2", v)
+	}
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,36 @@
+package neuron
+
+import (
+	"errors"
+
+	"neuron/pkg/cache"
+	"neuron/pkg/config"
+)
+
+// UseCache registers a module that builds the cache described by cfg when
+// the engine starts, using the drivers registered on factory, or the
+// built-in ones when factory is nil. Handlers receive it by injecting
+// cache.Cache.
+func (e *Engine) UseCache(cfg config.CacheConfig, factory *cache.Factory) error {
+	module := cache.NewModule(cfg, factory)
+	if err := e.RegisterModule(module); err != nil {
+		return err
+	}
+	e.cache = module
+
+	return Provide(e.container, func(in Injector) (cache.Cache, error) {
+		if c := module.Cache(); c != nil {
+			return c, nil
+		}
+		return nil, errors.New("cache module is not initialized")
+	})
+}
+
+// Cache returns the cache configured with UseCache, or nil before the
+// engine starts or without UseCache
+func (e *Engine) Cache() cache.Cache {
+	if e.cache == nil {
+		return nil
+	}
+	return e.cache.Cache()
+}
@@ -24,12 +24,55 @@ type AppConfig struct {
 }
 
 type ServerConfig struct {
-	Host            string `json:"host" yaml:"host"`
-	Port            int    `json:"port" yaml:"port"`
-	ReadTimeout     int    `json:"readTimeout" yaml:"readTimeout"`
-	WriteTimeout    int    `json:"writeTimeout" yaml:"writeTimeout"`
-	MaxHeaderBytes  int    `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
-	GracefulTimeout int    `json:"gracefulTimeout" yaml:"gracefulTimeout"`
+	Host            string      `json:"host" yaml:"host"`
+	Port            int         `json:"port" yaml:"port"`
+	ReadTimeout     int         `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout    int         `json:"writeTimeout" yaml:"writeTimeout"`
+	MaxHeaderBytes  int         `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
+	GracefulTimeout int         `json:"gracefulTimeout" yaml:"gracefulTimeout"`
+	TLS             TLSConfig   `json:"tls" yaml:"tls"`
+	HTTP2           HTTP2Config `json:"http2" yaml:"http2"`
+}
+
+// HTTP2Config holds HTTP/2 tuning. Zero values use the server defaults.
+type HTTP2Config struct {
+	// H2C enables cleartext HTTP/2 (prior knowledge and Upgrade: h2c) when
+	// TLS is not enabled
+	H2C                          bool   `json:"h2c" yaml:"h2c"`
+	MaxConcurrentStreams         uint32 `json:"maxConcurrentStreams" yaml:"maxConcurrentStreams"`
+	MaxReadFrameSize             uint32 `json:"maxReadFrameSize" yaml:"maxReadFrameSize"`
+	IdleTimeout                  int    `json:"idleTimeout" yaml:"idleTimeout"`
+	MaxUploadBufferPerConnection int32  `json:"maxUploadBufferPerConnection" yaml:"maxUploadBufferPerConnection"`
+	MaxUploadBufferPerStream     int32  `json:"maxUploadBufferPerStream" yaml:"maxUploadBufferPerStream"`
+}
+
+// TLSConfig holds TLS termination configuration
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+
+	// Certificates are additional certificates selected by SNI server name
+	Certificates []TLSCertificate `json:"certificates" yaml:"certificates"`
+
+	// ClientCAFile is a PEM bundle used to verify client certificates (mTLS)
+	ClientCAFile string `json:"clientCAFile" yaml:"clientCAFile"`
+	// ClientAuth is one of "none", "request", "require", "verify-if-given"
+	// or "require-and-verify". Defaults to "require-and-verify" when
+	// ClientCAFile is set.
+	ClientAuth string `json:"clientAuth" yaml:"clientAuth"`
+
+	// ReloadInterval is how often, in seconds, certificate files are checked
+	// for changes. Zero uses the default; a negative value disables reloading.
+	ReloadInterval int    `json:"reloadInterval" yaml:"reloadInterval"`
+	MinVersion     string `json:"minVersion" yaml:"minVersion"`
+}
+
+// TLSCertificate is a certificate/key pair served for the given server names
+type TLSCertificate struct {
+	CertFile    string   `json:"certFile" yaml:"certFile"`
+	KeyFile     string   `json:"keyFile" yaml:"keyFile"`
+	ServerNames []string `json:"serverNames" yaml:"serverNames"`
 }
 
 type DatabaseConfig struct {
@@ -54,6 +97,17 @@ type CacheConfig struct {
 	MaxRetries int    `json:"maxRetries" yaml:"maxRetries"`
 	PoolSize   int    `json:"poolSize" yaml:"poolSize"`
 	DefaultTTL int    `json:"defaultTTL" yaml:"defaultTTL"`
+	Prefix     string `json:"prefix" yaml:"prefix"`
+
+	// Addrs lists the nodes for the redis-cluster driver, or the sentinels
+	// for redis-sentinel, which also needs MasterName
+	Addrs      []string `json:"addrs" yaml:"addrs"`
+	MasterName string   `json:"masterName" yaml:"masterName"`
+
+	// Memory driver limits and eviction policy
+	MaxEntries int    `json:"maxEntries" yaml:"maxEntries"`
+	MaxMemory  int64  `json:"maxMemory" yaml:"maxMemory"`
+	Eviction   string `json:"eviction" yaml:"eviction"`
 }
 
 // SecurityConfig holds security-related configuration
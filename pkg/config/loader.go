@@ -118,6 +118,9 @@ func mergeConfig(dst, src *Config) error {
 	if src.App.Environment != "" {
 		dst.App.Environment = src.App.Environment
 	}
+	if src.Cache.Driver != "" {
+		dst.Cache = src.Cache
+	}
 	// Add other fields as needed
 	return nil
 }
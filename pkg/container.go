@@ -0,0 +1,340 @@
+package neuron
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"neuron/pkg/router"
+)
+
+// ErrMissingDependency is returned when no provider is registered for a type
+var ErrMissingDependency = errors.New("missing dependency")
+
+// scopeKey is the router.Context key holding request-scoped instances
+const scopeKey = "neuron.scope"
+
+// Scope controls how long a provided instance lives
+type Scope int
+
+const (
+	// Singleton instances are built once and shared
+	Singleton Scope = iota
+	// RequestScoped instances are built once per request
+	RequestScoped
+)
+
+// Injector resolves dependencies by type. *Container implements it, and
+// providers receive one to resolve their own dependencies.
+type Injector interface {
+	resolve(t reflect.Type) (interface{}, error)
+}
+
+// Container is a typed dependency injection container. Providers are
+// registered per type with Provide or ProvideScoped and resolved with
+// Resolve or injected into handlers with Inject.
+type Container struct {
+	mu        sync.RWMutex
+	providers map[reflect.Type]*provider
+	required  map[reflect.Type]bool
+	// validated is set by Validate; later requirements are checked as they
+	// are declared
+	validated bool
+}
+
+type provider struct {
+	scope Scope
+	build func(in Injector, rc *router.Context) (interface{}, error)
+
+	mu    sync.Mutex
+	built bool
+	value interface{}
+}
+
+// resolution carries the types being built, to detect cycles, and the
+// request for request-scoped providers
+type resolution struct {
+	container *Container
+	stack     []reflect.Type
+	request   *router.Context
+}
+
+// NewContainer creates an empty container
+func NewContainer() *Container {
+	return &Container{
+		providers: make(map[reflect.Type]*provider),
+		required:  make(map[reflect.Type]bool),
+	}
+}
+
+// Provide registers a singleton provider for T. fn runs at most once, on
+// first use or during Validate, whichever comes first.
+func Provide[T any](c *Container, fn func(in Injector) (T, error)) error {
+	return c.register(typeOf[T](), &provider{
+		scope: Singleton,
+		build: func(in Injector, _ *router.Context) (interface{}, error) {
+			return fn(in)
+		},
+	})
+}
+
+// ProvideValue registers an existing value as the singleton for T
+func ProvideValue[T any](c *Container, value T) error {
+	return c.register(typeOf[T](), &provider{
+		scope: Singleton,
+		built: true,
+		value: value,
+	})
+}
+
+// ProvideScoped registers a request-scoped provider for T. fn runs at most
+// once per request.
+func ProvideScoped[T any](c *Container, fn func(in Injector, rc *router.Context) (T, error)) error {
+	return c.register(typeOf[T](), &provider{
+		scope: RequestScoped,
+		build: func(in Injector, rc *router.Context) (interface{}, error) {
+			return fn(in, rc)
+		},
+	})
+}
+
+// Require declares that T must be resolvable, so Validate fails at startup
+// instead of on first use. A requirement declared after Validate, such as
+// by a route registered with Inject after Start, is logged at once if T has
+// no provider.
+func Require[T any](c *Container) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := typeOf[T]()
+	c.required[t] = true
+	if _, ok := c.providers[t]; c.validated && !ok {
+		log.Printf("Dependency injection: %v: no provider for %s", ErrMissingDependency, t)
+	}
+}
+
+// Resolve returns the instance of T
+func Resolve[T any](in Injector) (T, error) {
+	var zero T
+	value, err := in.resolve(typeOf[T]())
+	if err != nil {
+		return zero, err
+	}
+	// A nil value provided for an interface type stays the zero value
+	typed, _ := value.(T)
+	return typed, nil
+}
+
+// MustResolve returns the instance of T and panics if it cannot be resolved
+func MustResolve[T any](in Injector) T {
+	value, err := Resolve[T](in)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// ResolveRequest returns the instance of T for the request, resolving
+// request-scoped providers as well as singletons
+func ResolveRequest[T any](c *Container, rc *router.Context) (T, error) {
+	return Resolve[T](&resolution{container: c, request: rc})
+}
+
+// Inject wraps a handler that needs a dependency of type T. The dependency
+// is required at startup and resolved for each request.
+func Inject[T any](c *Container, h func(rc *router.Context, dep T) error) router.HandlerFunc {
+	Require[T](c)
+	return func(rc *router.Context) error {
+		dep, err := ResolveRequest[T](c, rc)
+		if err != nil {
+			return err
+		}
+		return h(rc, dep)
+	}
+}
+
+// Inject2 wraps a handler that needs dependencies of types A and B
+func Inject2[A, B any](c *Container, h func(rc *router.Context, a A, b B) error) router.HandlerFunc {
+	Require[A](c)
+	Require[B](c)
+	return func(rc *router.Context) error {
+		a, err := ResolveRequest[A](c, rc)
+		if err != nil {
+			return err
+		}
+		b, err := ResolveRequest[B](c, rc)
+		if err != nil {
+			return err
+		}
+		return h(rc, a, b)
+	}
+}
+
+// Inject3 wraps a handler that needs dependencies of types A, B and C
+func Inject3[A, B, C any](c *Container, h func(rc *router.Context, a A, b B, cc C) error) router.HandlerFunc {
+	Require[A](c)
+	Require[B](c)
+	Require[C](c)
+	return func(rc *router.Context) error {
+		a, err := ResolveRequest[A](c, rc)
+		if err != nil {
+			return err
+		}
+		b, err := ResolveRequest[B](c, rc)
+		if err != nil {
+			return err
+		}
+		cc, err := ResolveRequest[C](c, rc)
+		if err != nil {
+			return err
+		}
+		return h(rc, a, b, cc)
+	}
+}
+
+// Validate checks that every required type has a provider and builds all
+// singletons, so missing or failing dependencies surface at startup.
+//
+// Request-scoped providers are not run, since they need a request, so a
+// dependency that only a request-scoped provider resolves is reported on
+// the first request that needs it. Neither are requirements declared after
+// Validate; Require logs those that have no provider.
+func (c *Container) Validate() error {
+	c.mu.Lock()
+	c.validated = true
+	c.mu.Unlock()
+
+	c.mu.RLock()
+	var errs []error
+	for t := range c.required {
+		if _, ok := c.providers[t]; !ok {
+			errs = append(errs, fmt.Errorf("%w: no provider for %s", ErrMissingDependency, t))
+		}
+	}
+	singletons := make([]reflect.Type, 0, len(c.providers))
+	for t, p := range c.providers {
+		if p.scope == Singleton {
+			singletons = append(singletons, t)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, t := range singletons {
+		if _, err := c.resolve(t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Container) register(t reflect.Type, p *provider) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.providers[t]; exists {
+		return fmt.Errorf("provider for %s is already registered", t)
+	}
+	c.providers[t] = p
+	return nil
+}
+
+func (c *Container) resolve(t reflect.Type) (interface{}, error) {
+	return (&resolution{container: c}).resolve(t)
+}
+
+func (r *resolution) resolve(t reflect.Type) (interface{}, error) {
+	for i, s := range r.stack {
+		if s == t {
+			names := make([]string, 0, len(r.stack)-i+1)
+			for _, st := range r.stack[i:] {
+				names = append(names, st.String())
+			}
+			names = append(names, t.String())
+			return nil, fmt.Errorf("dependency cycle: %s", strings.Join(names, " -> "))
+		}
+	}
+
+	r.container.mu.RLock()
+	p, ok := r.container.providers[t]
+	r.container.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: no provider for %s", ErrMissingDependency, t)
+	}
+
+	next := &resolution{
+		container: r.container,
+		stack:     append(r.stack[:len(r.stack):len(r.stack)], t),
+		request:   r.request,
+	}
+
+	if p.scope == RequestScoped {
+		return next.resolveScoped(t, p)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.built {
+		return p.value, nil
+	}
+
+	// Singletons never see the request
+	next.request = nil
+	value, err := p.build(next, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provide %s: %w", t, err)
+	}
+	p.value = value
+	p.built = true
+	return value, nil
+}
+
+func (r *resolution) resolveScoped(t reflect.Type, p *provider) (interface{}, error) {
+	if r.request == nil {
+		return nil, fmt.Errorf("%s is request-scoped and cannot be resolved outside a request", t)
+	}
+
+	var instances map[reflect.Type]interface{}
+	if v, ok := r.request.Get(scopeKey); ok {
+		instances = v.(map[reflect.Type]interface{})
+	} else {
+		instances = make(map[reflect.Type]interface{})
+		r.request.Set(scopeKey, instances)
+	}
+
+	if value, ok := instances[t]; ok {
+		return value, nil
+	}
+
+	value, err := p.build(r, r.request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provide %s: %w", t, err)
+	}
+	instances[t] = value
+	return value, nil
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// ModuleAs returns the module registered under name as type T
+func ModuleAs[T any](e *Engine, name string) (T, error) {
+	var zero T
+	module, err := e.GetModule(name)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := module.(T)
+	if !ok {
+		return zero, fmt.Errorf("module %s is %T, not %s", name, module, typeOf[T]())
+	}
+	return typed, nil
+}
+
+// Container returns the engine's dependency injection container
+func (e *Engine) Container() *Container {
+	return e.container
+}
@@ -0,0 +1,159 @@
+package neuron
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"neuron/pkg/cache"
+	"neuron/pkg/config"
+	"neuron/pkg/router"
+)
+
+type testDB struct{ dsn string }
+
+type testRepo struct{ db *testDB }
+
+type testTx struct{ id int }
+
+func TestContainer_Resolve(t *testing.T) {
+	c := NewContainer()
+
+	builds := 0
+	Provide(c, func(in Injector) (*testDB, error) {
+		builds++
+		return &testDB{dsn: "postgres://"}, nil
+	})
+	Provide(c, func(in Injector) (*testRepo, error) {
+		db, err := Resolve[*testDB](in)
+		return &testRepo{db: db}, err
+	})
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	repo, err := Resolve[*testRepo](c)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if repo.db == nil || repo.db.dsn != "postgres://" {
+		t.Errorf("repo.db = %+v, want injected database", repo.db)
+	}
+	if builds != 1 {
+		t.Errorf("singleton built %d times, want 1", builds)
+	}
+}
+
+func TestContainer_ValidateMissing(t *testing.T) {
+	c := NewContainer()
+	Provide(c, func(in Injector) (*testRepo, error) {
+		db, err := Resolve[*testDB](in)
+		return &testRepo{db: db}, err
+	})
+
+	err := c.Validate()
+	if !errors.Is(err, ErrMissingDependency) {
+		t.Fatalf("Validate() error = %v, want %v", err, ErrMissingDependency)
+	}
+	if !strings.Contains(err.Error(), "*neuron.testDB") {
+		t.Errorf("Validate() error = %v, want it to name the missing type", err)
+	}
+}
+
+func TestContainer_RequireAfterValidate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c := NewContainer()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	Inject(c, func(rc *router.Context, db *testDB) error { return nil })
+	if !strings.Contains(buf.String(), "no provider for *neuron.testDB") {
+		t.Errorf("log = %q, want the missing provider of a late Inject reported", buf.String())
+	}
+}
+
+func TestContainer_Cycle(t *testing.T) {
+	c := NewContainer()
+	Provide(c, func(in Injector) (*testDB, error) {
+		_, err := Resolve[*testRepo](in)
+		return &testDB{}, err
+	})
+	Provide(c, func(in Injector) (*testRepo, error) {
+		_, err := Resolve[*testDB](in)
+		return &testRepo{}, err
+	})
+
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("Validate() error = %v, want dependency cycle", err)
+	}
+}
+
+func TestContainer_InjectRequestScoped(t *testing.T) {
+	c := NewContainer()
+	ProvideValue(c, &testDB{dsn: "db"})
+
+	next := 0
+	ProvideScoped(c, func(in Injector, rc *router.Context) (*testTx, error) {
+		next++
+		return &testTx{id: next}, nil
+	})
+
+	var first, second *testTx
+	handler := Inject2(c, func(rc *router.Context, db *testDB, tx *testTx) error {
+		first = tx
+		second, _ = ResolveRequest[*testTx](c, rc)
+		return nil
+	})
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		rc := router.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		if err := handler(rc); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		if first.id != i || second != first {
+			t.Errorf("request %d got tx %d (shared: %v), want one tx %d per request", i, first.id, second == first, i)
+		}
+	}
+
+	if _, err := Resolve[*testTx](c); err == nil {
+		t.Error("Resolve() of request-scoped type outside a request succeeded")
+	}
+}
+
+func TestEngine_UseCache(t *testing.T) {
+	e := New(DefaultConfig())
+	if err := e.UseCache(config.CacheConfig{Driver: cache.DriverMemory}, nil); err != nil {
+		t.Fatalf("UseCache() error = %v", err)
+	}
+	if _, err := Resolve[cache.Cache](e.Container()); err == nil {
+		t.Error("Resolve() before Init error = nil, want not initialized")
+	}
+
+	ctx := context.Background()
+	if err := e.modules.InitializeModules(ctx); err != nil {
+		t.Fatalf("InitializeModules() error = %v", err)
+	}
+	defer e.modules.ShutdownModules(ctx)
+
+	c, err := Resolve[cache.Cache](e.Container())
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if c != e.Cache() {
+		t.Error("Resolve() and Cache() returned different caches")
+	}
+}
@@ -0,0 +1,111 @@
+package neuron
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DependentModule is implemented by modules that must be initialized after
+// other modules. DependsOn returns the names of those modules.
+type DependentModule interface {
+	Module
+	DependsOn() []string
+}
+
+// resolveOrder returns the modules in an order where every module follows
+// its dependencies. Independent modules keep their registration order. It
+// fails on unknown dependencies and dependency cycles. The caller must hold
+// mr.mu.
+func (mr *ModuleRegistry) resolveOrder() ([]Module, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(mr.modules))
+	order := make([]Module, 0, len(mr.modules))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// Report the cycle starting from the first occurrence of name
+			for i, n := range path {
+				if n == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("module dependency cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+
+		module := mr.modules[name]
+		if dep, ok := module.(DependentModule); ok {
+			for _, d := range dep.DependsOn() {
+				if _, exists := mr.modules[d]; !exists {
+					return fmt.Errorf("module %s depends on unknown module %s", name, d)
+				}
+				if err := visit(d); err != nil {
+					return err
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, module)
+		return nil
+	}
+
+	for _, name := range mr.order {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// initModule runs module.Init, giving up after timeout even if the module
+// ignores its context. A module whose Init still succeeds after timing out
+// is shut down as soon as it returns, since it will never be started.
+func initModule(ctx context.Context, module Module, timeout time.Duration) error {
+	if timeout <= 0 {
+		return module.Init(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- module.Init(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		go func() {
+			if err := <-done; err != nil {
+				return
+			}
+			log.Printf("Module %s initialized after timing out, shutting it down", module.Name())
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := module.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to shut down module %s: %v", module.Name(), err)
+			}
+		}()
+		return fmt.Errorf("init timed out after %v: %w", timeout, ctx.Err())
+	}
+}
@@ -0,0 +1,383 @@
+// Package event is an in-process publish/subscribe bus with typed topics.
+//
+// Each event type has a topic: the result of its Topic method if it has
+// one, otherwise its Go type name such as "billing.PaymentSettled". Topics
+// are dot-separated, and pattern subscriptions may use "*" to match one
+// segment and a trailing ">" to match one or more.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDraining is reported for async deliveries of events published after
+// Drain was called
+var ErrDraining = errors.New("event bus is draining")
+
+// Event is a published event as seen by pattern subscribers
+type Event struct {
+	Topic string
+	// Payload is the published value, or its JSON encoding as a
+	// json.RawMessage for events that arrived through a Transport
+	Payload interface{}
+	Time    time.Time
+}
+
+// Topicer is implemented by event types that name their own topic
+type Topicer interface {
+	Topic() string
+}
+
+// Handler handles events delivered to a pattern subscription
+type Handler func(ctx context.Context, evt Event) error
+
+// Executor runs asynchronous deliveries, e.g. on a worker pool
+type Executor interface {
+	Execute(fn func()) error
+}
+
+// Transport carries events between processes, e.g. over Redis Streams.
+// With a transport set, Publish hands events to it and the bus delivers
+// what Subscribe receives, including its own events.
+type Transport interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	// Subscribe calls deliver for every event published through the
+	// transport by any process until ctx is done
+	Subscribe(ctx context.Context, deliver func(topic string, data []byte)) error
+}
+
+// Options configures a Bus
+type Options struct {
+	// Executor runs async deliveries; defaults to a goroutine per delivery
+	Executor Executor
+
+	Transport Transport
+
+	// OnError is called for every subscriber that fails or panics
+	OnError func(evt Event, subscriber string, err error)
+}
+
+// SubscribeOptions control how a subscriber receives events
+type SubscribeOptions struct {
+	// Name identifies the subscriber in errors; defaults to its topic
+	Name string
+
+	// Async delivers events through the executor instead of in the
+	// publisher's goroutine. Async handlers outlive the publisher's
+	// context cancellation.
+	Async bool
+}
+
+// Bus delivers published events to matching subscribers. A failing or
+// panicking subscriber does not affect the others.
+type Bus struct {
+	mu      sync.RWMutex
+	options Options
+	nextID  uint64
+	pending sync.WaitGroup
+	// draining is set by Drain; no async delivery joins pending after it
+	draining bool
+
+	// subscribers are kept in subscription order, which is the order
+	// synchronous subscribers are called in
+	subscribers []*subscriber
+}
+
+type subscriber struct {
+	id      uint64
+	name    string
+	pattern []string
+	async   bool
+	handle  Handler
+	// decode turns transport data into the subscriber's payload type
+	decode func(data []byte) (interface{}, error)
+}
+
+// Subscription is a registered subscriber
+type Subscription struct {
+	bus *Bus
+	id  uint64
+}
+
+// NewBus creates a bus
+func NewBus(options Options) *Bus {
+	return &Bus{
+		options: options,
+	}
+}
+
+// SetExecutor replaces the executor used for async deliveries
+func (b *Bus) SetExecutor(executor Executor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.options.Executor = executor
+}
+
+// TopicOf returns the topic of events of type T. A type and a pointer to it
+// share a topic.
+func TopicOf[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	topicer := reflect.TypeOf((*Topicer)(nil)).Elem()
+	if reflect.PointerTo(t).Implements(topicer) {
+		return reflect.New(t).Interface().(Topicer).Topic()
+	}
+	return t.String()
+}
+
+// payloadAs returns v as a T, dereferencing it or taking its address when
+// it is the pointer or value form of T
+func payloadAs[T any](v interface{}) (T, bool) {
+	if payload, ok := v.(T); ok {
+		return payload, true
+	}
+
+	var zero T
+	want := reflect.TypeOf((*T)(nil)).Elem()
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid():
+	case rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Type().Elem() == want:
+		return rv.Elem().Interface().(T), true
+	case want.Kind() == reflect.Ptr && want.Elem() == rv.Type():
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		return p.Interface().(T), true
+	}
+	return zero, false
+}
+
+// Subscribe registers fn for events of type T
+func Subscribe[T any](b *Bus, fn func(ctx context.Context, evt T) error, opts SubscribeOptions) Subscription {
+	topic := TopicOf[T]()
+	handle := func(ctx context.Context, evt Event) error {
+		payload, ok := payloadAs[T](evt.Payload)
+		if !ok {
+			return fmt.Errorf("event %s has payload %T, want %T", evt.Topic, evt.Payload, payload)
+		}
+		return fn(ctx, payload)
+	}
+	decode := func(data []byte) (interface{}, error) {
+		var payload T
+		err := json.Unmarshal(data, &payload)
+		return payload, err
+	}
+	return b.subscribe(topic, handle, decode, opts)
+}
+
+// SubscribePattern registers fn for events whose topic matches pattern
+func (b *Bus) SubscribePattern(pattern string, fn Handler, opts SubscribeOptions) Subscription {
+	return b.subscribe(pattern, fn, nil, opts)
+}
+
+// Publish delivers evt to the subscribers of its topic. Synchronous
+// subscribers run in subscription order before Publish returns, and their
+// errors are joined into its result; async subscribers report errors to
+// Options.OnError.
+func Publish[T any](ctx context.Context, b *Bus, evt T) error {
+	topic := TopicOf[T]()
+
+	b.mu.RLock()
+	transport := b.options.Transport
+	b.mu.RUnlock()
+
+	if transport != nil {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", topic, err)
+		}
+		if err := transport.Publish(ctx, topic, data); err != nil {
+			return fmt.Errorf("failed to publish event %s: %w", topic, err)
+		}
+		return nil
+	}
+
+	return b.deliver(ctx, topic, func(*subscriber) (interface{}, error) {
+		return evt, nil
+	})
+}
+
+// Run delivers events arriving through the transport until ctx is done.
+// It returns at once without a transport.
+func (b *Bus) Run(ctx context.Context) error {
+	b.mu.RLock()
+	transport := b.options.Transport
+	b.mu.RUnlock()
+	if transport == nil {
+		return nil
+	}
+
+	return transport.Subscribe(ctx, func(topic string, data []byte) {
+		b.deliver(ctx, topic, func(s *subscriber) (interface{}, error) {
+			if s.decode == nil {
+				return json.RawMessage(data), nil
+			}
+			return s.decode(data)
+		})
+	})
+}
+
+// Drain waits for async deliveries in progress to finish, or for ctx.
+// Async deliveries of events published afterwards are dropped and reported
+// to Options.OnError with ErrDraining.
+func (b *Bus) Drain(ctx context.Context) error {
+	b.mu.Lock()
+	b.draining = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unsubscribe removes the subscriber
+func (s Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	for i, sub := range s.bus.subscribers {
+		if sub.id == s.id {
+			s.bus.subscribers = append(s.bus.subscribers[:i:i], s.bus.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *Bus) subscribe(pattern string, fn Handler, decode func([]byte) (interface{}, error), opts SubscribeOptions) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	name := opts.Name
+	if name == "" {
+		name = pattern
+	}
+	b.subscribers = append(b.subscribers, &subscriber{
+		id:      b.nextID,
+		name:    name,
+		pattern: strings.Split(pattern, "."),
+		async:   opts.Async,
+		handle:  fn,
+		decode:  decode,
+	})
+	return Subscription{bus: b, id: b.nextID}
+}
+
+// deliver runs every subscriber matching topic with the payload returned
+// for it
+func (b *Bus) deliver(ctx context.Context, topic string, payload func(*subscriber) (interface{}, error)) error {
+	segments := strings.Split(topic, ".")
+
+	// Async deliveries join pending under the lock, so none starts once
+	// Drain is waiting
+	b.mu.RLock()
+	executor := b.options.Executor
+	draining := b.draining
+	matched := make([]*subscriber, 0)
+	async := 0
+	for _, s := range b.subscribers {
+		if match(s.pattern, segments) {
+			matched = append(matched, s)
+			if s.async {
+				async++
+			}
+		}
+	}
+	if !draining {
+		b.pending.Add(async)
+	}
+	b.mu.RUnlock()
+
+	now := time.Now()
+	var errs []error
+	for _, s := range matched {
+		value, err := payload(s)
+		evt := Event{Topic: topic, Payload: value, Time: now}
+		if err != nil {
+			if s.async && !draining {
+				b.pending.Done()
+			}
+			b.report(evt, s, fmt.Errorf("failed to decode event: %w", err))
+			continue
+		}
+
+		if !s.async {
+			if err := b.call(ctx, s, evt); err != nil {
+				errs = append(errs, fmt.Errorf("subscriber %s: %w", s.name, err))
+			}
+			continue
+		}
+
+		if draining {
+			b.report(evt, s, ErrDraining)
+			continue
+		}
+
+		s := s
+		asyncCtx := context.WithoutCancel(ctx)
+		run := func() {
+			defer b.pending.Done()
+			b.call(asyncCtx, s, evt)
+		}
+
+		if executor == nil {
+			go run()
+		} else if err := executor.Execute(run); err != nil {
+			b.pending.Done()
+			b.report(evt, s, fmt.Errorf("failed to schedule delivery: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// call runs one subscriber, recovering panics and reporting failures
+func (b *Bus) call(ctx context.Context, s *subscriber, evt Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked: %v", r)
+		}
+		if err != nil {
+			b.report(evt, s, err)
+		}
+	}()
+	return s.handle(ctx, evt)
+}
+
+func (b *Bus) report(evt Event, s *subscriber, err error) {
+	if b.options.OnError != nil {
+		b.options.OnError(evt, s.name, err)
+	}
+}
+
+// match reports whether topic segments match a pattern, where "*" matches
+// one segment and a trailing ">" matches the rest
+func match(pattern, topic []string) bool {
+	for i, p := range pattern {
+		if p == ">" && i == len(pattern)-1 {
+			return len(topic) > i
+		}
+		if i >= len(topic) || (p != "*" && p != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
@@ -0,0 +1,260 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type PaymentSettled struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+}
+
+func (PaymentSettled) Topic() string { return "payment.settled" }
+
+type PaymentFailed struct {
+	ID string `json:"id"`
+}
+
+func (PaymentFailed) Topic() string { return "payment.failed" }
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"payment.settled", "payment.settled", true},
+		{"payment.settled", "payment.failed", false},
+		{"payment.*", "payment.settled", true},
+		{"payment.*", "payment.card.settled", false},
+		{"payment.>", "payment.card.settled", true},
+		{"payment.>", "payment", false},
+		{"*.settled", "payment.settled", true},
+		{"payment", "payment.settled", false},
+	}
+
+	for _, tt := range tests {
+		if got := match(strings.Split(tt.pattern, "."), strings.Split(tt.topic, ".")); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	var mu sync.Mutex
+	var reported []string
+	b := NewBus(Options{OnError: func(evt Event, subscriber string, err error) {
+		mu.Lock()
+		reported = append(reported, subscriber)
+		mu.Unlock()
+	}})
+
+	var settled []PaymentSettled
+	Subscribe(b, func(ctx context.Context, evt PaymentSettled) error {
+		settled = append(settled, evt)
+		return nil
+	}, SubscribeOptions{})
+	Subscribe(b, func(ctx context.Context, evt PaymentSettled) error {
+		panic("ledger bug")
+	}, SubscribeOptions{Name: "ledger"})
+
+	var topics []string
+	b.SubscribePattern("payment.*", func(ctx context.Context, evt Event) error {
+		topics = append(topics, evt.Topic)
+		return nil
+	}, SubscribeOptions{})
+
+	async := make(chan string, 1)
+	Subscribe(b, func(ctx context.Context, evt PaymentFailed) error {
+		async <- evt.ID
+		return nil
+	}, SubscribeOptions{Async: true})
+
+	err := Publish(context.Background(), b, PaymentSettled{ID: "p-1", Amount: 500})
+	if err == nil {
+		t.Error("Publish() error = nil, want the ledger subscriber's panic")
+	}
+	// The panicking subscriber did not stop the others
+	if len(settled) != 1 || settled[0].ID != "p-1" {
+		t.Errorf("settled = %+v, want p-1", settled)
+	}
+	if len(reported) != 1 || reported[0] != "ledger" {
+		t.Errorf("reported subscribers = %v, want [ledger]", reported)
+	}
+
+	if err := Publish(context.Background(), b, PaymentFailed{ID: "p-2"}); err != nil {
+		t.Errorf("Publish() error = %v", err)
+	}
+	if id := <-async; id != "p-2" {
+		t.Errorf("async subscriber got %s, want p-2", id)
+	}
+	if err := b.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	if len(topics) != 2 || topics[0] != "payment.settled" || topics[1] != "payment.failed" {
+		t.Errorf("pattern subscriber topics = %v", topics)
+	}
+}
+
+// loopback is a transport that delivers to its own subscriber
+type loopback struct {
+	deliver chan func(topic string, data []byte)
+}
+
+func (l *loopback) Publish(ctx context.Context, topic string, data []byte) error {
+	(<-l.deliver)(topic, data)
+	return nil
+}
+
+func (l *loopback) Subscribe(ctx context.Context, deliver func(topic string, data []byte)) error {
+	for {
+		select {
+		case l.deliver <- deliver:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestBus_Transport(t *testing.T) {
+	b := NewBus(Options{Transport: &loopback{deliver: make(chan func(string, []byte))}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	var got PaymentSettled
+	var raw json.RawMessage
+	Subscribe(b, func(ctx context.Context, evt PaymentSettled) error {
+		got = evt
+		return nil
+	}, SubscribeOptions{})
+	b.SubscribePattern("payment.>", func(ctx context.Context, evt Event) error {
+		raw = evt.Payload.(json.RawMessage)
+		return errors.New("ignored")
+	}, SubscribeOptions{})
+
+	if err := Publish(ctx, b, PaymentSettled{ID: "p-3", Amount: 100}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got.ID != "p-3" || got.Amount != 100 {
+		t.Errorf("typed subscriber got %+v, want p-3", got)
+	}
+	if string(raw) != `{"id":"p-3","amount":100}` {
+		t.Errorf("pattern subscriber got %s", raw)
+	}
+}
+
+func TestBus_DeliveryOrder(t *testing.T) {
+	b := NewBus(Options{})
+
+	var order []string
+	subscribe := func(name string) Subscription {
+		return b.SubscribePattern("payment.*", func(ctx context.Context, evt Event) error {
+			order = append(order, name)
+			return nil
+		}, SubscribeOptions{Name: name})
+	}
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	subs := make([]Subscription, len(names))
+	for i, name := range names {
+		subs[i] = subscribe(name)
+	}
+	subs[2].Unsubscribe()
+	subscribe("i")
+
+	for i := 0; i < 10; i++ {
+		order = nil
+		if err := Publish(context.Background(), b, PaymentSettled{ID: "p-1"}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if got := strings.Join(order, ""); got != "abdefghi" {
+			t.Fatalf("delivery order = %s, want abdefghi", got)
+		}
+	}
+}
+
+func TestBus_Drain(t *testing.T) {
+	var mu sync.Mutex
+	var dropped int
+	b := NewBus(Options{OnError: func(evt Event, subscriber string, err error) {
+		if errors.Is(err, ErrDraining) {
+			mu.Lock()
+			dropped++
+			mu.Unlock()
+		}
+	}})
+
+	var delivered sync.WaitGroup
+	Subscribe(b, func(ctx context.Context, evt PaymentFailed) error {
+		delivered.Done()
+		return nil
+	}, SubscribeOptions{Async: true})
+
+	// Publishing concurrently with Drain either delivers or drops each event
+	var publishers sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		publishers.Add(1)
+		delivered.Add(1)
+		go func() {
+			defer publishers.Done()
+			Publish(context.Background(), b, PaymentFailed{ID: "p-1"})
+		}()
+	}
+	if err := b.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	publishers.Wait()
+
+	mu.Lock()
+	for i := 0; i < dropped; i++ {
+		delivered.Done()
+	}
+	mu.Unlock()
+	delivered.Wait()
+
+	Publish(context.Background(), b, PaymentFailed{ID: "p-2"})
+	mu.Lock()
+	defer mu.Unlock()
+	if dropped == 0 {
+		t.Error("async delivery after Drain was not dropped")
+	}
+}
+
+type OrderShipped struct {
+	ID string `json:"id"`
+}
+
+func TestTopicOf_Pointers(t *testing.T) {
+	if got, want := TopicOf[*PaymentSettled](), TopicOf[PaymentSettled](); got != want {
+		t.Errorf("TopicOf[*PaymentSettled]() = %s, want %s", got, want)
+	}
+	if got, want := TopicOf[*OrderShipped](), "event.OrderShipped"; got != want {
+		t.Errorf("TopicOf[*OrderShipped]() = %s, want %s", got, want)
+	}
+
+	b := NewBus(Options{})
+	var byValue, byPointer []string
+	Subscribe(b, func(ctx context.Context, evt OrderShipped) error {
+		byValue = append(byValue, evt.ID)
+		return nil
+	}, SubscribeOptions{})
+	Subscribe(b, func(ctx context.Context, evt *OrderShipped) error {
+		byPointer = append(byPointer, evt.ID)
+		return nil
+	}, SubscribeOptions{})
+
+	if err := Publish(context.Background(), b, &OrderShipped{ID: "o-1"}); err != nil {
+		t.Fatalf("Publish(*OrderShipped) error = %v", err)
+	}
+	if err := Publish(context.Background(), b, OrderShipped{ID: "o-2"}); err != nil {
+		t.Fatalf("Publish(OrderShipped) error = %v", err)
+	}
+	if strings.Join(byValue, ",") != "o-1,o-2" || strings.Join(byPointer, ",") != "o-1,o-2" {
+		t.Errorf("delivered by value %v and by pointer %v, want both events to both", byValue, byPointer)
+	}
+}
@@ -0,0 +1,24 @@
+package neuron
+
+import "neuron/pkg/event"
+
+// Events returns the engine's event bus. Async subscribers run on the
+// worker pool when one is configured.
+func (e *Engine) Events() *event.Bus {
+	return e.events
+}
+
+// poolExecutor runs async event deliveries as worker pool jobs
+type poolExecutor struct {
+	pool *WorkerPool
+}
+
+func (x poolExecutor) Execute(fn func()) error {
+	return x.pool.Submit(Job{
+		Name: "event",
+		Handler: func() error {
+			fn()
+			return nil
+		},
+	})
+}
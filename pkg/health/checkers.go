@@ -0,0 +1,22 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+
+	"neuron/pkg/cache"
+)
+
+// SQL checks a database connection pool with a ping
+func SQL(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// Redis checks a Redis cache connection with a ping
+func Redis(c *cache.RedisCache) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return c.Ping(ctx)
+	})
+}
@@ -0,0 +1,231 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status values reported for checks and reports
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Kind selects which checks a report runs
+type Kind int
+
+const (
+	// Liveness runs only checks marked as liveness checks
+	Liveness Kind = iota
+	// Readiness runs every check
+	Readiness
+)
+
+// ErrNotReady is reported while the application is starting or draining
+var ErrNotReady = errors.New("not ready")
+
+// Checker reports the health of a dependency
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface
+type CheckerFunc func(ctx context.Context) error
+
+// Check implements Checker
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check is a named health check
+type Check struct {
+	Name    string
+	Checker Checker
+	// Timeout bounds a single run; zero uses Options.Timeout
+	Timeout time.Duration
+	// Liveness includes the check in liveness reports. Readiness reports
+	// always include every check.
+	Liveness bool
+}
+
+// Options configures a Registry
+type Options struct {
+	// Timeout is the default per-check timeout
+	Timeout time.Duration
+	// CacheTTL is how long a check result is reused before running the
+	// check again
+	CacheTTL time.Duration
+	// Ready gates readiness; when it returns false the readiness report is
+	// down regardless of the checks
+	Ready func() bool
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report aggregates check results
+type Report struct {
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Registry runs health checks with timeouts and caches their results
+type Registry struct {
+	mu      sync.RWMutex
+	checks  []*entry
+	options Options
+}
+
+type entry struct {
+	check Check
+
+	mu     sync.Mutex
+	result Result
+	at     time.Time
+}
+
+// NewRegistry creates a health check registry
+func NewRegistry(opts Options) *Registry {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.CacheTTL < 0 {
+		opts.CacheTTL = 0
+	}
+	return &Registry{options: opts}
+}
+
+// Register adds a readiness check
+func (r *Registry) Register(name string, checker Checker) {
+	r.Add(Check{Name: name, Checker: checker})
+}
+
+// Add adds a check
+func (r *Registry) Add(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &entry{check: check})
+}
+
+// Run runs the checks of the given kind concurrently and aggregates them
+func (r *Registry) Run(ctx context.Context, kind Kind) Report {
+	report := Report{Status: StatusUp, Checks: make(map[string]Result)}
+
+	if kind == Readiness && r.options.Ready != nil && !r.options.Ready() {
+		report.Status = StatusDown
+		report.Error = ErrNotReady.Error()
+	}
+
+	r.mu.RLock()
+	entries := make([]*entry, 0, len(r.checks))
+	for _, e := range r.checks {
+		if kind == Readiness || e.check.Liveness {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = r.run(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, e := range entries {
+		report.Checks[e.check.Name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+// run executes a check unless a cached result is still fresh
+func (r *Registry) run(ctx context.Context, e *entry) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r.options.CacheTTL > 0 && !e.at.IsZero() && time.Since(e.at) < r.options.CacheTTL {
+		return e.result
+	}
+
+	timeout := e.check.Timeout
+	if timeout <= 0 {
+		timeout = r.options.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := runCheck(ctx, e.check.Checker)
+
+	result := Result{
+		Status:    StatusUp,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	e.result = result
+	e.at = start
+	return result
+}
+
+// runCheck runs a checker, giving up when ctx is done even if the checker
+// ignores it
+func runCheck(ctx context.Context, checker Checker) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- checker.Check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// Handler serves a JSON report of the given kind, with status 200 when up
+// and 503 when down
+func (r *Registry) Handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context(), kind)
+
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
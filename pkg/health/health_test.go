@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	ready := true
+	r := NewRegistry(Options{Timeout: 20 * time.Millisecond, Ready: func() bool { return ready }})
+
+	r.Add(Check{Name: "process", Liveness: true, Checker: CheckerFunc(func(ctx context.Context) error {
+		return nil
+	})})
+	r.Register("db", CheckerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+	r.Register("slow", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+
+	live := r.Run(context.Background(), Liveness)
+	if live.Status != StatusUp || len(live.Checks) != 1 {
+		t.Errorf("liveness = %+v, want up with only the liveness check", live)
+	}
+
+	report := r.Run(context.Background(), Readiness)
+	if report.Status != StatusDown {
+		t.Errorf("readiness status = %s, want down", report.Status)
+	}
+	if got := report.Checks["db"].Error; got != "connection refused" {
+		t.Errorf("db error = %q, want connection refused", got)
+	}
+	if got := report.Checks["slow"].Status; got != StatusDown {
+		t.Errorf("slow check status = %s, want down after timeout", got)
+	}
+
+	ready = false
+	r = NewRegistry(Options{Ready: func() bool { return ready }})
+	if got := r.Run(context.Background(), Readiness); got.Status != StatusDown || got.Error != ErrNotReady.Error() {
+		t.Errorf("readiness while draining = %+v, want down and not ready", got)
+	}
+}
+
+func TestRegistry_CacheTTL(t *testing.T) {
+	calls := 0
+	r := NewRegistry(Options{CacheTTL: time.Minute})
+	r.Register("db", CheckerFunc(func(ctx context.Context) error {
+		calls++
+		return nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		r.Run(context.Background(), Readiness)
+	}
+	if calls != 1 {
+		t.Errorf("check ran %d times, want 1 with cached results", calls)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry(Options{})
+	r.Register("cache", CheckerFunc(func(ctx context.Context) error {
+		return errors.New("timeout")
+	}))
+
+	rec := httptest.NewRecorder()
+	r.Handler(Readiness).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+	if report.Checks["cache"].Error != "timeout" {
+		t.Errorf("report = %+v, want cache check error", report)
+	}
+}
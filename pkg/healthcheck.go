@@ -0,0 +1,52 @@
+package neuron
+
+import (
+	"context"
+	"errors"
+
+	"neuron/pkg/health"
+)
+
+// HealthChecker is implemented by modules that can report their health.
+// Initialized modules implementing it are added to the readiness checks.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// Health returns the engine's health check registry, for adding checks that
+// are not modules
+func (e *Engine) Health() *health.Registry {
+	return e.health
+}
+
+// enableHealth registers module and worker pool checks and serves them on
+// /healthz (liveness) and /readyz (readiness)
+func (e *Engine) enableHealth() {
+	for _, module := range e.modules.running() {
+		if checker, ok := module.(HealthChecker); ok {
+			e.health.Register(module.Name(), checker)
+		}
+	}
+
+	if e.pool != nil {
+		e.health.Register("worker_pool", e.pool)
+	}
+
+	e.router.GET("/healthz", wrapHandler(e.health.Handler(health.Liveness)))
+	e.router.GET("/readyz", wrapHandler(e.health.Handler(health.Readiness)))
+}
+
+// Check reports the pool as unhealthy once it is shut down or when its
+// queue is full
+func (p *WorkerPool) Check(ctx context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errors.New("worker pool is shut down")
+	}
+	if len(p.queue) == cap(p.queue) {
+		return errors.New("worker pool queue is full")
+	}
+	return nil
+}
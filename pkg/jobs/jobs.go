@@ -0,0 +1,327 @@
+// Package jobs runs durable background jobs on a neuron.WorkerPool.
+//
+// Job types are registered with a typed handler and enqueued with a typed
+// payload, which is stored as JSON. Delivery is at-least-once: a reserved
+// job stays hidden for the visibility timeout and is delivered again if its
+// worker does not finish it in time, so handlers must be idempotent.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	neuron "neuron/pkg"
+)
+
+// Config configures a Queue
+type Config struct {
+	Store Store
+
+	// Concurrency is the number of jobs run at once
+	Concurrency int
+
+	// PollInterval is how often the store is polled for due jobs
+	PollInterval time.Duration
+
+	// VisibilityTimeout is how long a reserved job stays hidden. It also
+	// bounds each run: the handler's context expires with it.
+	VisibilityTimeout time.Duration
+
+	// MaxAttempts is the default number of attempts before a job is
+	// dead-lettered
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubling on each later
+	// retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// OnDead is called when a job is moved to the dead-letter queue
+	OnDead func(job *Job, err error)
+}
+
+// Options control how a single job is enqueued
+type Options struct {
+	// Delay postpones the job; ignored if RunAt is set
+	Delay time.Duration
+	// RunAt schedules the job for a specific time
+	RunAt time.Time
+	// UniqueKey rejects the job with ErrDuplicate while another job with
+	// the same key is queued or running
+	UniqueKey string
+	// MaxAttempts overrides the queue default
+	MaxAttempts int
+}
+
+// Queue dispatches stored jobs to registered handlers. It is a neuron
+// Module and Runner: register it with the engine and it polls for work
+// while the engine runs.
+type Queue struct {
+	config Config
+	pool   *neuron.WorkerPool
+
+	mu       sync.RWMutex
+	handlers map[string]handler
+
+	slots chan struct{}
+	wake  chan struct{}
+}
+
+type handler struct {
+	payload reflect.Type
+	run     func(ctx context.Context, payload []byte) error
+}
+
+// New creates a queue, filling in defaults for zero values
+func New(config Config) *Queue {
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 10
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = 5 * time.Minute
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Hour
+	}
+
+	return &Queue{
+		config:   config,
+		handlers: make(map[string]handler),
+		slots:    make(chan struct{}, config.Concurrency),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for jobs named name. Payloads are decoded from
+// JSON into T.
+func Register[T any](q *Queue, name string, fn func(ctx context.Context, payload T) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[name] = handler{
+		payload: reflect.TypeOf((*T)(nil)).Elem(),
+		run: func(ctx context.Context, data []byte) error {
+			var payload T
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return fmt.Errorf("failed to decode payload: %w", err)
+			}
+			return fn(ctx, payload)
+		},
+	}
+}
+
+// Enqueue stores a job named name with payload and returns its ID. If a
+// handler is registered for name, its payload type must be T.
+func Enqueue[T any](ctx context.Context, q *Queue, name string, payload T, opts Options) (string, error) {
+	q.mu.RLock()
+	h, ok := q.handlers[name]
+	q.mu.RUnlock()
+	if ok && h.payload != reflect.TypeOf((*T)(nil)).Elem() {
+		return "", fmt.Errorf("job %s takes %s, not %T", name, h.payload, payload)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	now := time.Now()
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = now.Add(opts.Delay)
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.config.MaxAttempts
+	}
+
+	job := &Job{
+		ID:          newID(),
+		Type:        name,
+		Payload:     data,
+		UniqueKey:   opts.UniqueKey,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+	}
+	if err := q.config.Store.Enqueue(ctx, job); err != nil {
+		return "", err
+	}
+
+	if !runAt.After(now) {
+		q.notify()
+	}
+	return job.ID, nil
+}
+
+// Name implements neuron.Module
+func (q *Queue) Name() string {
+	return "jobs"
+}
+
+// Init implements neuron.Module
+func (q *Queue) Init(ctx context.Context) error {
+	q.pool = neuron.NewWorkerPoolWithConfig(neuron.WorkerPoolConfig{
+		Size:      q.config.Concurrency,
+		QueueSize: q.config.Concurrency,
+	})
+	return nil
+}
+
+// Run polls the store and dispatches due jobs until ctx is done. Jobs still
+// running when ctx is done see their context cancelled and are released
+// back to the store.
+func (q *Queue) Run(ctx context.Context) error {
+	if q.pool == nil {
+		return errors.New("jobs queue is not initialized")
+	}
+
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// Shutdown implements neuron.Module, waiting for running jobs to finish
+func (q *Queue) Shutdown(ctx context.Context) error {
+	if q.pool == nil {
+		return nil
+	}
+	return q.pool.Shutdown(ctx)
+}
+
+// Dead returns up to limit dead-lettered jobs
+func (q *Queue) Dead(ctx context.Context, limit int) ([]*Job, error) {
+	return q.config.Store.Dead(ctx, limit)
+}
+
+// dispatch reserves as many due jobs as there are free slots and hands them
+// to the pool
+func (q *Queue) dispatch(ctx context.Context) {
+	free := cap(q.slots) - len(q.slots)
+	if free == 0 || ctx.Err() != nil {
+		return
+	}
+
+	jobs, err := q.config.Store.Reserve(ctx, time.Now(), free, q.config.VisibilityTimeout)
+	if err != nil {
+		log.Printf("Failed to reserve jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		job := job
+		q.slots <- struct{}{}
+		err := q.pool.Submit(neuron.Job{
+			Name:    job.Type,
+			Handler: func() error { return q.process(ctx, job) },
+		})
+		if err != nil {
+			// The job reappears once its visibility timeout expires
+			<-q.slots
+			log.Printf("Failed to dispatch job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// process runs a reserved job and records the outcome in the store
+func (q *Queue) process(ctx context.Context, job *Job) error {
+	defer func() {
+		<-q.slots
+		q.notify()
+	}()
+
+	err := q.execute(ctx, job)
+
+	// Record the outcome even if the run context is already cancelled
+	storeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var storeErr error
+	switch {
+	case err == nil:
+		storeErr = q.config.Store.Complete(storeCtx, job)
+	case ctx.Err() != nil:
+		// Shutting down: release the job without waiting for a backoff or
+		// counting the interrupted attempt
+		storeErr = q.config.Store.Release(storeCtx, job)
+	case job.Attempts >= job.MaxAttempts:
+		storeErr = q.config.Store.Bury(storeCtx, job, err)
+		if storeErr == nil && q.config.OnDead != nil {
+			q.config.OnDead(job, err)
+		}
+	default:
+		storeErr = q.config.Store.Retry(storeCtx, job, time.Now().Add(q.backoff(job.Attempts)), err)
+	}
+
+	if storeErr != nil {
+		log.Printf("Failed to record outcome of job %s: %v", job.ID, storeErr)
+	}
+	return err
+}
+
+// execute runs the job's handler within its visibility timeout
+func (q *Queue) execute(ctx context.Context, job *Job) (err error) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler registered for job %s", job.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.config.VisibilityTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h.run(ctx, job.Payload)
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.config.Backoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= q.config.MaxBackoff {
+			return q.config.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	_ "modernc.org/sqlite"
+)
+
+func TestStores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{"memory", NewMemoryStore()},
+		{"redis", NewRedisStore(client, "test")},
+		{"redis cluster", NewRedisStore(redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}}), "cluster")},
+		{"sqlite", newSQLiteStore(t)},
+	}
+
+	for _, tt := range stores {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			testStore(t, tt.store)
+		})
+	}
+}
+
+func TestRedisStore_HashTag(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "")
+	ctx := context.Background()
+
+	job := &Job{ID: "a", Type: "receipt", UniqueKey: "order-1", MaxAttempts: 1, RunAt: time.Now(), CreatedAt: time.Now()}
+	if err := s.Enqueue(ctx, job); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	jobs, err := s.Reserve(ctx, time.Now(), 1, time.Minute)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Reserve() = %v, %v", jobs, err)
+	}
+	s.Bury(ctx, jobs[0], errors.New("gave up"))
+
+	// Every key shares the {jobs} hash tag, and so one cluster slot
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, "{jobs}:") {
+			t.Errorf("key %s is outside the {jobs} hash tag", key)
+		}
+	}
+}
+
+// newSQLiteStore returns a migrated SQLStore on a private in-memory database
+func newSQLiteStore(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	s := NewSQLStore(db, SQLConfig{Dialect: "sqlite"})
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	// Migrating twice is a no-op
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+	return s
+}
+
+// testStore checks the Store contract
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	enqueue := func(id, unique string, runAt time.Time) error {
+		return s.Enqueue(ctx, &Job{
+			ID: id, Type: "receipt", Payload: []byte(`{"id":1}`), UniqueKey: unique,
+			MaxAttempts: 3, RunAt: runAt, CreatedAt: now,
+		})
+	}
+
+	if err := enqueue("a", "order-1", now.Add(-time.Second)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := enqueue("b", "order-1", now); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Enqueue() duplicate error = %v, want ErrDuplicate", err)
+	}
+	if err := enqueue("later", "", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	jobs, err := s.Reserve(ctx, now, 10, time.Minute)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Reserve() = %d jobs, %v, want 1", len(jobs), err)
+	}
+	job := jobs[0]
+	if job.ID != "a" || job.Attempts != 1 || string(job.Payload) != `{"id":1}` {
+		t.Fatalf("Reserve() job = %+v", job)
+	}
+
+	// Hidden until the visibility timeout expires, then delivered again
+	if jobs, _ := s.Reserve(ctx, now, 10, time.Minute); len(jobs) != 0 {
+		t.Fatalf("Reserve() during visibility timeout = %d jobs, want 0", len(jobs))
+	}
+	redelivered, err := s.Reserve(ctx, now.Add(2*time.Minute), 1, time.Minute)
+	if err != nil || len(redelivered) != 1 || redelivered[0].Attempts != 2 {
+		t.Fatalf("Reserve() after timeout = %+v, %v, want attempt 2", redelivered, err)
+	}
+
+	// The first reservation has lost its lease
+	if err := s.Complete(ctx, job); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Complete() stale lease error = %v, want ErrLeaseLost", err)
+	}
+
+	job = redelivered[0]
+	if err := s.Retry(ctx, job, now.Add(3*time.Minute), errors.New("smtp down")); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	jobs, _ = s.Reserve(ctx, now.Add(3*time.Minute), 1, time.Minute)
+	if len(jobs) != 1 || jobs[0].LastError != "smtp down" {
+		t.Fatalf("Reserve() after Retry = %+v", jobs)
+	}
+
+	// Releasing refunds the attempt and makes the job due at once
+	attempts := jobs[0].Attempts
+	if err := s.Release(ctx, jobs[0]); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	jobs, _ = s.Reserve(ctx, time.Now(), 1, time.Minute)
+	if len(jobs) != 1 || jobs[0].Attempts != attempts {
+		t.Fatalf("Reserve() after Release = %+v, want attempt %d", jobs, attempts)
+	}
+
+	if err := s.Bury(ctx, jobs[0], errors.New("gave up")); err != nil {
+		t.Fatalf("Bury() error = %v", err)
+	}
+	dead, err := s.Dead(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != "a" || dead[0].LastError != "gave up" {
+		t.Fatalf("Dead() = %+v, %v", dead, err)
+	}
+
+	// Burying released the unique key
+	if err := enqueue("c", "order-1", now); err != nil {
+		t.Fatalf("Enqueue() after Bury error = %v", err)
+	}
+	jobs, _ = s.Reserve(ctx, now.Add(2*time.Hour), 10, time.Minute)
+	if len(jobs) != 2 {
+		t.Fatalf("Reserve() = %d jobs, want 2", len(jobs))
+	}
+	for _, job := range jobs {
+		if err := s.Complete(ctx, job); err != nil {
+			t.Fatalf("Complete() error = %v", err)
+		}
+	}
+	if jobs, _ := s.Reserve(ctx, now.Add(48*time.Hour), 10, time.Minute); len(jobs) != 0 {
+		t.Fatalf("Reserve() after Complete = %d jobs, want 0", len(jobs))
+	}
+}
+
+type receipt struct {
+	OrderID string `json:"orderId"`
+}
+
+func TestQueue(t *testing.T) {
+	dead := make(chan *Job, 1)
+	q := New(Config{
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  2,
+		Backoff:      time.Millisecond,
+		OnDead:       func(job *Job, err error) { dead <- job },
+	})
+
+	sent := make(chan string, 1)
+	var failures int32
+	Register(q, "receipt", func(ctx context.Context, r receipt) error {
+		sent <- r.OrderID
+		return nil
+	})
+	Register(q, "reconcile", func(ctx context.Context, batch int) error {
+		atomic.AddInt32(&failures, 1)
+		return errors.New("ledger unavailable")
+	})
+
+	if err := q.Init(context.Background()); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+	defer func() {
+		cancel()
+		q.Shutdown(context.Background())
+	}()
+
+	if _, err := Enqueue(ctx, q, "receipt", receipt{OrderID: "o-1"}, Options{UniqueKey: "o-1"}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := Enqueue(ctx, q, "receipt", 42, Options{}); err == nil {
+		t.Error("Enqueue() with wrong payload type succeeded, want error")
+	}
+	if _, err := Enqueue(ctx, q, "reconcile", 7, Options{}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	select {
+	case id := <-sent:
+		if id != "o-1" {
+			t.Errorf("handler got order %s, want o-1", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receipt job did not run")
+	}
+
+	select {
+	case job := <-dead:
+		if job.Type != "reconcile" || atomic.LoadInt32(&failures) != 2 {
+			t.Errorf("dead job %s after %d failures, want reconcile after 2", job.Type, atomic.LoadInt32(&failures))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failing job was not dead-lettered")
+	}
+}
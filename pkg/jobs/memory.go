@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs in process memory. Jobs do not survive a restart,
+// so it is meant for tests and development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	unique map[string]string
+	dead   []*Job
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:   make(map[string]*Job),
+		unique: make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Enqueue(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.UniqueKey != "" {
+		if _, taken := s.unique[job.UniqueKey]; taken {
+			return ErrDuplicate
+		}
+		s.unique[job.UniqueKey] = job.ID
+	}
+
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, now time.Time, n int, visibility time.Duration) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := make([]*Job, 0)
+	for _, job := range s.jobs {
+		if !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	if len(due) > n {
+		due = due[:n]
+	}
+
+	reserved := make([]*Job, 0, len(due))
+	for _, job := range due {
+		job.Attempts++
+		job.RunAt = now.Add(visibility)
+		job.Token = newID()
+		copied := *job
+		reserved = append(reserved, &copied)
+	}
+	return reserved, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.lease(job)
+	if err != nil {
+		return err
+	}
+	s.remove(stored)
+	return nil
+}
+
+func (s *MemoryStore) Retry(ctx context.Context, job *Job, runAt time.Time, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, leaseErr := s.lease(job)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	stored.RunAt = runAt
+	stored.LastError = errString(err)
+	stored.Token = ""
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.lease(job)
+	if err != nil {
+		return err
+	}
+	stored.Attempts--
+	stored.RunAt = time.Now()
+	stored.Token = ""
+	return nil
+}
+
+func (s *MemoryStore) Bury(ctx context.Context, job *Job, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, leaseErr := s.lease(job)
+	if leaseErr != nil {
+		return leaseErr
+	}
+	s.remove(stored)
+	stored.LastError = errString(err)
+	stored.Token = ""
+	s.dead = append(s.dead, stored)
+	return nil
+}
+
+func (s *MemoryStore) Dead(ctx context.Context, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dead := make([]*Job, 0, limit)
+	for i := len(s.dead) - 1; i >= 0 && len(dead) < limit; i-- {
+		copied := *s.dead[i]
+		dead = append(dead, &copied)
+	}
+	return dead, nil
+}
+
+// lease returns the stored job if job still holds its reservation
+func (s *MemoryStore) lease(job *Job) (*Job, error) {
+	stored, ok := s.jobs[job.ID]
+	if !ok || stored.Token != job.Token {
+		return nil, ErrLeaseLost
+	}
+	return stored, nil
+}
+
+func (s *MemoryStore) remove(job *Job) {
+	delete(s.jobs, job.ID)
+	if job.UniqueKey != "" && s.unique[job.UniqueKey] == job.ID {
+		delete(s.unique, job.UniqueKey)
+	}
+}
@@ -0,0 +1,244 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps jobs in Redis. Each job is a hash; due and reserved jobs
+// are scored by run time in a sorted set, and every state change runs as a
+// Lua script so it is atomic.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a store on client with keys under prefix, which
+// defaults to "jobs". The prefix is used as a hash tag, as in "{jobs}:queue",
+// so the keys a script touches share a slot on Redis Cluster.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "jobs"
+	}
+	return &RedisStore{client: client, prefix: "{" + prefix + "}"}
+}
+
+// KEYS: queue, unique, job
+// ARGV: id, unique key, run at, fields...
+var enqueueScript = redis.NewScript(`
+if ARGV[2] ~= '' and redis.call('HSETNX', KEYS[2], ARGV[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[3], unpack(ARGV, 4))
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// KEYS: queue
+// ARGV: now, limit, hidden until, token base, job key prefix
+var reserveScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local jobs = {}
+for i, id in ipairs(ids) do
+	local key = ARGV[5] .. id
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+	redis.call('HINCRBY', key, 'attempts', 1)
+	redis.call('HSET', key, 'token', ARGV[4] .. ':' .. i, 'run_at', ARGV[3])
+	jobs[i] = redis.call('HGETALL', key)
+end
+return jobs
+`)
+
+// KEYS: queue, unique, job
+// ARGV: id, token
+var completeScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], 'token') ~= ARGV[2] then
+	return 0
+end
+local unique = redis.call('HGET', KEYS[3], 'unique_key')
+if unique and unique ~= '' and redis.call('HGET', KEYS[2], unique) == ARGV[1] then
+	redis.call('HDEL', KEYS[2], unique)
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[3])
+return 1
+`)
+
+// KEYS: queue, job
+// ARGV: id, token, run at, error
+var retryScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], 'token') ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'token', '', 'run_at', ARGV[3], 'last_error', ARGV[4])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// KEYS: queue, job
+// ARGV: id, token, run at
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], 'token') ~= ARGV[2] then
+	return 0
+end
+redis.call('HINCRBY', KEYS[2], 'attempts', -1)
+redis.call('HSET', KEYS[2], 'token', '', 'run_at', ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// KEYS: queue, unique, job, dead
+// ARGV: id, token, error
+var buryScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], 'token') ~= ARGV[2] then
+	return 0
+end
+local unique = redis.call('HGET', KEYS[3], 'unique_key')
+if unique and unique ~= '' and redis.call('HGET', KEYS[2], unique) == ARGV[1] then
+	redis.call('HDEL', KEYS[2], unique)
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[3], 'token', '', 'last_error', ARGV[3])
+redis.call('LPUSH', KEYS[4], ARGV[1])
+return 1
+`)
+
+func (s *RedisStore) Enqueue(ctx context.Context, job *Job) error {
+	runAt := job.RunAt.UnixMilli()
+	args := []interface{}{
+		job.ID, job.UniqueKey, runAt,
+		"id", job.ID,
+		"type", job.Type,
+		"payload", job.Payload,
+		"unique_key", job.UniqueKey,
+		"attempts", job.Attempts,
+		"max_attempts", job.MaxAttempts,
+		"run_at", runAt,
+		"token", "",
+		"last_error", "",
+		"created_at", job.CreatedAt.UnixMilli(),
+	}
+
+	ok, err := enqueueScript.Run(ctx, s.client, []string{s.queueKey(), s.uniqueKey(), s.jobKey(job.ID)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	if ok == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, now time.Time, n int, visibility time.Duration) ([]*Job, error) {
+	res, err := reserveScript.Run(ctx, s.client, []string{s.queueKey()},
+		now.UnixMilli(), n, now.Add(visibility).UnixMilli(), newID(), s.jobKey("")).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(res))
+	for _, fields := range res {
+		values, ok := fields.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected reserve reply %T", fields)
+		}
+		jobs = append(jobs, decodeRedisJob(values))
+	}
+	return jobs, nil
+}
+
+func (s *RedisStore) Complete(ctx context.Context, job *Job) error {
+	return s.run(ctx, completeScript, []string{s.queueKey(), s.uniqueKey(), s.jobKey(job.ID)},
+		job.ID, job.Token)
+}
+
+func (s *RedisStore) Retry(ctx context.Context, job *Job, runAt time.Time, err error) error {
+	return s.run(ctx, retryScript, []string{s.queueKey(), s.jobKey(job.ID)},
+		job.ID, job.Token, runAt.UnixMilli(), errString(err))
+}
+
+func (s *RedisStore) Release(ctx context.Context, job *Job) error {
+	return s.run(ctx, releaseScript, []string{s.queueKey(), s.jobKey(job.ID)},
+		job.ID, job.Token, time.Now().UnixMilli())
+}
+
+func (s *RedisStore) Bury(ctx context.Context, job *Job, err error) error {
+	return s.run(ctx, buryScript, []string{s.queueKey(), s.uniqueKey(), s.jobKey(job.ID), s.deadKey()},
+		job.ID, job.Token, errString(err))
+}
+
+func (s *RedisStore) Dead(ctx context.Context, limit int) ([]*Job, error) {
+	ids, err := s.client.LRange(ctx, s.deadKey(), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		fields, err := s.client.HGetAll(ctx, s.jobKey(id)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load dead job %s: %w", id, err)
+		}
+		values := make([]interface{}, 0, len(fields)*2)
+		for k, v := range fields {
+			values = append(values, k, v)
+		}
+		jobs = append(jobs, decodeRedisJob(values))
+	}
+	return jobs, nil
+}
+
+// run executes a script guarded by the reservation token
+func (s *RedisStore) run(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) error {
+	ok, err := script.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if ok == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *RedisStore) queueKey() string        { return s.prefix + ":queue" }
+func (s *RedisStore) uniqueKey() string       { return s.prefix + ":unique" }
+func (s *RedisStore) deadKey() string         { return s.prefix + ":dead" }
+func (s *RedisStore) jobKey(id string) string { return s.prefix + ":job:" + id }
+
+// decodeRedisJob builds a job from a flat field/value list
+func decodeRedisJob(values []interface{}) *Job {
+	job := &Job{}
+	for i := 0; i+1 < len(values); i += 2 {
+		field, _ := values[i].(string)
+		value, _ := values[i+1].(string)
+		switch field {
+		case "id":
+			job.ID = value
+		case "type":
+			job.Type = value
+		case "payload":
+			job.Payload = []byte(value)
+		case "unique_key":
+			job.UniqueKey = value
+		case "attempts":
+			job.Attempts, _ = strconv.Atoi(value)
+		case "max_attempts":
+			job.MaxAttempts, _ = strconv.Atoi(value)
+		case "run_at":
+			ms, _ := strconv.ParseInt(value, 10, 64)
+			job.RunAt = time.UnixMilli(ms)
+		case "token":
+			job.Token = value
+		case "last_error":
+			job.LastError = value
+		case "created_at":
+			ms, _ := strconv.ParseInt(value, 10, 64)
+			job.CreatedAt = time.UnixMilli(ms)
+		}
+	}
+	return job
+}
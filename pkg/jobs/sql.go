@@ -0,0 +1,275 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLConfig configures a SQLStore
+type SQLConfig struct {
+	// Table defaults to "jobs"
+	Table string
+
+	// Dialect is "postgres" (default), "mysql" or "sqlite". Postgres uses
+	// $1 placeholders, the others use ?, and MySQL gets its own DDL.
+	Dialect string
+}
+
+// SQLStore keeps jobs in a database table through database/sql. Dead jobs
+// stay in the table with dead set.
+type SQLStore struct {
+	db     *sql.DB
+	config SQLConfig
+}
+
+// NewSQLStore creates a store on db. Call Migrate to create the table.
+func NewSQLStore(db *sql.DB, config SQLConfig) *SQLStore {
+	if config.Table == "" {
+		config.Table = "jobs"
+	}
+	if config.Dialect == "" {
+		config.Dialect = "postgres"
+	}
+	return &SQLStore{db: db, config: config}
+}
+
+// Migrate creates the jobs table and its indexes if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	// MySQL accepts neither IF NOT EXISTS on CREATE INDEX nor a default on
+	// TEXT columns, so it declares the index inline and Enqueue always sets
+	// last_error
+	index := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_due ON %s (dead, run_at)`, s.config.Table, s.config.Table)
+	inline := ""
+	if s.config.Dialect == "mysql" {
+		inline = fmt.Sprintf(`,
+			INDEX %s_due (dead, run_at)`, s.config.Table)
+		index = ""
+	}
+
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(64) PRIMARY KEY,
+			type VARCHAR(255) NOT NULL,
+			payload TEXT NOT NULL,
+			unique_key VARCHAR(255) UNIQUE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			run_at BIGINT NOT NULL,
+			token VARCHAR(64) NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL,
+			dead INTEGER NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL%s
+		)`, s.config.Table, inline),
+	}
+	if index != "" {
+		statements = append(statements, index)
+	}
+
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate jobs table: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Enqueue(ctx context.Context, job *Job) error {
+	if job.UniqueKey != "" {
+		taken, err := s.uniqueTaken(ctx, job.UniqueKey)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicate
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, s.query(`INSERT INTO %s
+		(id, type, payload, unique_key, attempts, max_attempts, run_at, last_error, created_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?, '', ?)`),
+		job.ID, job.Type, string(job.Payload), nullString(job.UniqueKey),
+		job.MaxAttempts, job.RunAt.UnixMilli(), job.CreatedAt.UnixMilli())
+	if err != nil {
+		// A concurrent enqueue may have taken the key since the check
+		if job.UniqueKey != "" {
+			if taken, checkErr := s.uniqueTaken(ctx, job.UniqueKey); checkErr == nil && taken {
+				return ErrDuplicate
+			}
+		}
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+// Reserve selects due jobs and claims each with a conditional update, so
+// concurrent reservers never claim the same job twice
+func (s *SQLStore) Reserve(ctx context.Context, now time.Time, n int, visibility time.Duration) ([]*Job, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT id, token FROM %s
+		WHERE dead = 0 AND run_at <= ? ORDER BY run_at LIMIT ?`), now.UnixMilli(), n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due jobs: %w", err)
+	}
+
+	type candidate struct{ id, token string }
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.token); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan due job: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select due jobs: %w", err)
+	}
+
+	hidden := now.Add(visibility).UnixMilli()
+	reserved := make([]*Job, 0, len(candidates))
+	for _, c := range candidates {
+		token := newID()
+		res, err := s.db.ExecContext(ctx, s.query(`UPDATE %s
+			SET attempts = attempts + 1, run_at = ?, token = ?
+			WHERE id = ? AND token = ? AND dead = 0 AND run_at <= ?`),
+			hidden, token, c.id, c.token, now.UnixMilli())
+		if err != nil {
+			return reserved, fmt.Errorf("failed to reserve job %s: %w", c.id, err)
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			// Claimed by another reserver
+			continue
+		}
+
+		job, err := s.get(ctx, c.id)
+		if err != nil {
+			return reserved, err
+		}
+		reserved = append(reserved, job)
+	}
+	return reserved, nil
+}
+
+func (s *SQLStore) Complete(ctx context.Context, job *Job) error {
+	return s.exec(ctx, `DELETE FROM %s WHERE id = ? AND token = ?`, job.ID, job.Token)
+}
+
+func (s *SQLStore) Retry(ctx context.Context, job *Job, runAt time.Time, err error) error {
+	return s.exec(ctx, `UPDATE %s SET run_at = ?, last_error = ?, token = '' WHERE id = ? AND token = ?`,
+		runAt.UnixMilli(), errString(err), job.ID, job.Token)
+}
+
+func (s *SQLStore) Release(ctx context.Context, job *Job) error {
+	return s.exec(ctx, `UPDATE %s SET attempts = attempts - 1, run_at = ?, token = '' WHERE id = ? AND token = ?`,
+		time.Now().UnixMilli(), job.ID, job.Token)
+}
+
+func (s *SQLStore) Bury(ctx context.Context, job *Job, err error) error {
+	return s.exec(ctx, `UPDATE %s SET dead = 1, unique_key = NULL, last_error = ?, token = '', run_at = ?
+		WHERE id = ? AND token = ?`,
+		errString(err), time.Now().UnixMilli(), job.ID, job.Token)
+}
+
+func (s *SQLStore) Dead(ctx context.Context, limit int) ([]*Job, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT `+sqlColumns+` FROM %s
+		WHERE dead = 1 ORDER BY run_at DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+const sqlColumns = `id, type, payload, unique_key, attempts, max_attempts, run_at, token, last_error, created_at`
+
+func (s *SQLStore) get(ctx context.Context, id string) (*Job, error) {
+	row := s.db.QueryRowContext(ctx, s.query(`SELECT `+sqlColumns+` FROM %s WHERE id = ?`), id)
+	return scanJob(row)
+}
+
+func (s *SQLStore) uniqueTaken(ctx context.Context, key string) (bool, error) {
+	var id string
+	err := s.db.QueryRowContext(ctx, s.query(`SELECT id FROM %s WHERE unique_key = ?`), key).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check unique key: %w", err)
+	}
+	return true, nil
+}
+
+// exec runs a statement that must affect the reserved job, returning
+// ErrLeaseLost if the reservation token no longer matches
+func (s *SQLStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.db.ExecContext(ctx, s.query(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// query fills in the table name and rewrites ? placeholders for the dialect
+func (s *SQLStore) query(q string) string {
+	q = fmt.Sprintf(q, s.config.Table)
+	if s.config.Dialect != "postgres" {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var (
+		job       Job
+		payload   string
+		uniqueKey sql.NullString
+		runAt     int64
+		createdAt int64
+	)
+	err := row.Scan(&job.ID, &job.Type, &payload, &uniqueKey, &job.Attempts, &job.MaxAttempts,
+		&runAt, &job.Token, &job.LastError, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan job: %w", err)
+	}
+	job.Payload = []byte(payload)
+	job.UniqueKey = uniqueKey.String
+	job.RunAt = time.UnixMilli(runAt)
+	job.CreatedAt = time.UnixMilli(createdAt)
+	return &job, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned when enqueueing a job whose unique key is
+	// held by a job that has not yet completed or been dead-lettered
+	ErrDuplicate = errors.New("job with this unique key is already queued")
+	// ErrLeaseLost is returned when a job's visibility timeout expired and
+	// it was reserved again before the first reservation finished it
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// Job is a stored unit of background work
+type Job struct {
+	ID          string
+	Type        string
+	Payload     []byte
+	UniqueKey   string
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LastError   string
+	CreatedAt   time.Time
+
+	// Token identifies the current reservation
+	Token string
+}
+
+// Store persists jobs. Reserved jobs stay in the store, hidden until their
+// visibility timeout expires, so a job whose worker dies is delivered again.
+type Store interface {
+	// Enqueue stores a new job, returning ErrDuplicate if its unique key is
+	// taken
+	Enqueue(ctx context.Context, job *Job) error
+
+	// Reserve claims up to n jobs due at now, hides them until
+	// now+visibility, increments their attempts and sets a new Token
+	Reserve(ctx context.Context, now time.Time, n int, visibility time.Duration) ([]*Job, error)
+
+	// Complete removes a reserved job
+	Complete(ctx context.Context, job *Job) error
+
+	// Retry records err and makes a reserved job due again at runAt
+	Retry(ctx context.Context, job *Job, runAt time.Time, err error) error
+
+	// Release makes a reserved job due again immediately without counting
+	// the attempt Reserve recorded, for jobs interrupted by a shutdown
+	Release(ctx context.Context, job *Job) error
+
+	// Bury records err and moves a reserved job to the dead-letter queue,
+	// releasing its unique key
+	Bury(ctx context.Context, job *Job, err error) error
+
+	// Dead returns up to limit dead-lettered jobs, most recent first
+	Dead(ctx context.Context, limit int) ([]*Job, error)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
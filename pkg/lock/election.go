@@ -0,0 +1,137 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ElectionConfig configures an Election
+type ElectionConfig struct {
+	// Key is the lock that the leader holds
+	Key string
+
+	// TTL is the leader's lease; a leader that stops renewing is replaced
+	// once it expires. Defaults to 15 seconds.
+	TTL time.Duration
+
+	// RenewInterval is how often the leader extends its lease and
+	// followers try to take it. Defaults to a third of TTL.
+	RenewInterval time.Duration
+
+	// OnElected is called in its own goroutine when leadership is gained.
+	// Its context is cancelled when leadership is lost.
+	OnElected func(ctx context.Context)
+
+	// OnDemoted is called when leadership is lost
+	OnDemoted func()
+}
+
+// Election keeps one leader among the replicas competing for a key. It
+// implements neuron.Module and neuron.Runner, so replicas campaign while
+// the engine runs.
+type Election struct {
+	locker Locker
+	config ElectionConfig
+	leader atomic.Bool
+}
+
+// NewElection creates an election on locker
+func NewElection(locker Locker, config ElectionConfig) *Election {
+	if config.TTL <= 0 {
+		config.TTL = 15 * time.Second
+	}
+	if config.RenewInterval <= 0 {
+		config.RenewInterval = config.TTL / 3
+	}
+	return &Election{locker: locker, config: config}
+}
+
+// IsLeader reports whether this replica currently holds the lease
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Name implements neuron.Module
+func (e *Election) Name() string {
+	return "election:" + e.config.Key
+}
+
+// Init implements neuron.Module
+func (e *Election) Init(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown implements neuron.Module. The lease is released when Run returns.
+func (e *Election) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Run campaigns for leadership until ctx is done, releasing the lease on
+// the way out if it is held
+func (e *Election) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.config.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		l, err := e.locker.TryLock(ctx, e.config.Key, e.config.TTL)
+		switch {
+		case err == nil:
+			e.lead(ctx, l, ticker)
+		case !errors.Is(err, ErrNotAcquired) && ctx.Err() == nil:
+			log.Printf("Failed to campaign for %s: %v", e.config.Key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead holds leadership, renewing the lease, until a renewal fails or ctx
+// is done
+func (e *Election) lead(ctx context.Context, l *Lock, ticker *time.Ticker) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.leader.Store(true)
+	if e.config.OnElected != nil {
+		go e.config.OnElected(leaderCtx)
+	}
+
+	defer func() {
+		cancel()
+		e.leader.Store(false)
+
+		// Hand over at once rather than leaving followers to wait out the
+		// lease; fails harmlessly if the lease was already lost
+		releaseCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		if err := l.Unlock(releaseCtx); err != nil && !errors.Is(err, ErrNotHeld) {
+			log.Printf("Failed to release leadership of %s: %v", e.config.Key, err)
+		}
+
+		if e.config.OnDemoted != nil {
+			e.config.OnDemoted()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Step down on any failure: without a renewal this replica cannot
+		// be sure it still holds the lease
+		if err := l.Extend(ctx, e.config.TTL); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Lost leadership of %s: %v", e.config.Key, err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package lock provides distributed locks on Redis and Postgres and leader
+// election built on them.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned by TryLock when another owner holds the lock
+	ErrNotAcquired = errors.New("lock is held by another owner")
+	// ErrNotHeld is returned by Unlock and Extend once the lock has expired
+	// or been taken over
+	ErrNotHeld = errors.New("lock is not held")
+)
+
+// DefaultRetryInterval is how often Lock retries a held lock
+const DefaultRetryInterval = 100 * time.Millisecond
+
+// Locker acquires locks that expire after a TTL unless extended
+type Locker interface {
+	// TryLock acquires key for ttl or returns ErrNotAcquired at once
+	TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// Lock waits until key can be acquired or ctx is done
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+}
+
+// Lock is a held lock
+type Lock struct {
+	Key string
+	// Token identifies this holder; only it can release or extend the lock
+	Token string
+	// Fence increases with every acquisition of the key. Pass it to
+	// downstream systems so they can reject writes from a holder whose
+	// lock has since expired.
+	Fence int64
+
+	backend backend
+}
+
+type backend interface {
+	release(ctx context.Context, l *Lock) error
+	extend(ctx context.Context, l *Lock, ttl time.Duration) error
+}
+
+// Unlock releases the lock if it is still held by this holder
+func (l *Lock) Unlock(ctx context.Context) error {
+	return l.backend.release(ctx, l)
+}
+
+// Extend resets the lock's TTL if it is still held by this holder
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	return l.backend.extend(ctx, l, ttl)
+}
+
+// wait retries try until it acquires the lock, fails with another error,
+// or ctx is done
+func wait(ctx context.Context, try func() (*Lock, error)) (*Lock, error) {
+	ticker := time.NewTicker(DefaultRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		l, err := try()
+		if !errors.Is(err, ErrNotAcquired) {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
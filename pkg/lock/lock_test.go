@@ -0,0 +1,114 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newRedisLocker(t *testing.T) (*RedisLocker, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return NewRedisLocker(client, ""), mr
+}
+
+func TestRedisLocker(t *testing.T) {
+	locker, mr := newRedisLocker(t)
+	ctx := context.Background()
+
+	first, err := locker.TryLock(ctx, "settlement", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock() error = %v", err)
+	}
+	if _, err := locker.TryLock(ctx, "settlement", time.Second); !errors.Is(err, ErrNotAcquired) {
+		t.Fatalf("TryLock() on held lock error = %v, want ErrNotAcquired", err)
+	}
+
+	// Expire the first holder; its successor gets a higher fence and the
+	// first holder can no longer release or extend the lock
+	mr.FastForward(2 * time.Second)
+	second, err := locker.TryLock(ctx, "settlement", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock() after expiry error = %v", err)
+	}
+	if second.Fence <= first.Fence {
+		t.Errorf("fence = %d, want greater than %d", second.Fence, first.Fence)
+	}
+	if err := first.Unlock(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("stale Unlock() error = %v, want ErrNotHeld", err)
+	}
+	if err := first.Extend(ctx, time.Second); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("stale Extend() error = %v, want ErrNotHeld", err)
+	}
+
+	if err := second.Extend(ctx, time.Minute); err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+	if ttl := mr.TTL("lock:{settlement}"); ttl != time.Minute {
+		t.Errorf("TTL after Extend = %v, want 1m", ttl)
+	}
+	// The fence counter shares the lock's hash tag, and so its cluster slot
+	if !mr.Exists("lock:{settlement}:fence") {
+		t.Error("fence counter lock:{settlement}:fence does not exist")
+	}
+
+	// Lock waits for the holder to release
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		second.Unlock(ctx)
+	}()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := locker.Lock(waitCtx, "settlement", time.Second); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+}
+
+func TestElection(t *testing.T) {
+	locker, _ := newRedisLocker(t)
+
+	elected := make(chan string, 2)
+	demoted := make(chan string, 2)
+	newElection := func(name string) *Election {
+		return NewElection(locker, ElectionConfig{
+			Key:           "leader",
+			TTL:           time.Second,
+			RenewInterval: 20 * time.Millisecond,
+			OnElected:     func(ctx context.Context) { elected <- name },
+			OnDemoted:     func() { demoted <- name },
+		})
+	}
+
+	a, b := newElection("a"), newElection("b")
+	ctxA, stopA := context.WithCancel(context.Background())
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+
+	go a.Run(ctxA)
+	if got := <-elected; got != "a" {
+		t.Fatalf("first leader = %s, want a", got)
+	}
+	go b.Run(ctxB)
+	time.Sleep(50 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("b is leader while a holds the lease")
+	}
+
+	// a steps down and releases the lease, so b takes over
+	stopA()
+	if got := <-demoted; got != "a" {
+		t.Fatalf("demoted = %s, want a", got)
+	}
+	select {
+	case got := <-elected:
+		if got != "b" {
+			t.Fatalf("second leader = %s, want b", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("b was not elected after a stepped down")
+	}
+}
@@ -0,0 +1,143 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// PostgresLocker takes session-level advisory locks, each on its own pinned
+// connection. Advisory locks have no expiry of their own, so the locker
+// releases a lock when its TTL runs out; a crashed holder's lock is
+// released by Postgres when its connection drops.
+type PostgresLocker struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	leases map[string]*pgLease
+}
+
+type pgLease struct {
+	conn  *sql.Conn
+	id    int64
+	timer *time.Timer
+}
+
+// fenceSequence hands out fencing tokens for every key
+const fenceSequence = "neuron_lock_fence"
+
+// NewPostgresLocker creates a locker on db. Call Migrate to create the
+// sequence its fencing tokens come from.
+func NewPostgresLocker(db *sql.DB) *PostgresLocker {
+	return &PostgresLocker{
+		db:     db,
+		leases: make(map[string]*pgLease),
+	}
+}
+
+// Migrate creates the fencing token sequence if it does not exist
+func (p *PostgresLocker) Migrate(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, `CREATE SEQUENCE IF NOT EXISTS `+fenceSequence); err != nil {
+		return fmt.Errorf("failed to create lock fence sequence: %w", err)
+	}
+	return nil
+}
+
+// TryLock takes the advisory lock for key. Its fence is drawn from a
+// sequence once the lock is held, so it only increases across the cluster
+// and failed attempts do not consume values.
+func (p *PostgresLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+
+	id := advisoryID(key)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, id).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, ErrNotAcquired
+	}
+
+	var fence int64
+	if err := conn.QueryRowContext(ctx, `SELECT nextval('`+fenceSequence+`')`).Scan(&fence); err != nil {
+		// The connection goes back to the pool, so drop the session lock
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, id)
+		conn.Close()
+		return nil, fmt.Errorf("failed to fence lock %s: %w", key, err)
+	}
+
+	l := &Lock{Key: key, Token: newToken(), Fence: fence, backend: p}
+	lease := &pgLease{conn: conn, id: id}
+
+	p.mu.Lock()
+	p.leases[l.Token] = lease
+	lease.timer = time.AfterFunc(ttl, func() {
+		// Expired: release in the background
+		p.release(context.Background(), l)
+	})
+	p.mu.Unlock()
+
+	return l, nil
+}
+
+func (p *PostgresLocker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return wait(ctx, func() (*Lock, error) {
+		return p.TryLock(ctx, key, ttl)
+	})
+}
+
+func (p *PostgresLocker) release(ctx context.Context, l *Lock) error {
+	p.mu.Lock()
+	lease, ok := p.leases[l.Token]
+	delete(p.leases, l.Token)
+	p.mu.Unlock()
+	if !ok {
+		return ErrNotHeld
+	}
+
+	lease.timer.Stop()
+	defer lease.conn.Close()
+
+	if _, err := lease.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lease.id); err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.Key, err)
+	}
+	return nil
+}
+
+func (p *PostgresLocker) extend(ctx context.Context, l *Lock, ttl time.Duration) error {
+	p.mu.Lock()
+	lease, ok := p.leases[l.Token]
+	if ok && !lease.timer.Stop() {
+		// The expiry timer already fired and is releasing the lock
+		ok = false
+	}
+	if ok {
+		lease.timer.Reset(ttl)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return ErrNotHeld
+	}
+
+	// Make sure the session holding the lock is still alive
+	if err := lease.conn.PingContext(ctx); err != nil {
+		p.release(context.Background(), l)
+		return fmt.Errorf("failed to extend lock %s: %w", l.Key, err)
+	}
+	return nil
+}
+
+// advisoryID maps a key to the 64-bit advisory lock ID space
+func advisoryID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
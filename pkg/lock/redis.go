@@ -0,0 +1,97 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisLocker takes locks with SET NX PX. Releasing and extending compare
+// the holder's token first, in a Lua script, so a holder whose lock expired
+// cannot release or extend its successor's lock.
+type RedisLocker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLocker creates a locker with keys under prefix, which defaults to
+// "lock:"
+func NewRedisLocker(client redis.UniversalClient, prefix string) *RedisLocker {
+	if prefix == "" {
+		prefix = "lock:"
+	}
+	return &RedisLocker{client: client, prefix: prefix}
+}
+
+// KEYS: lock, fence counter
+// ARGV: token, ttl in milliseconds
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// KEYS: lock
+// ARGV: token
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// KEYS: lock
+// ARGV: token, ttl in milliseconds
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+func (r *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token := newToken()
+	fence, err := acquireScript.Run(ctx, r.client,
+		[]string{r.lockKey(key), r.lockKey(key) + ":fence"}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if fence == 0 {
+		return nil, ErrNotAcquired
+	}
+	return &Lock{Key: key, Token: token, Fence: fence, backend: r}, nil
+}
+
+func (r *RedisLocker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return wait(ctx, func() (*Lock, error) {
+		return r.TryLock(ctx, key, ttl)
+	})
+}
+
+func (r *RedisLocker) release(ctx context.Context, l *Lock) error {
+	return r.run(ctx, releaseScript, l, l.Token)
+}
+
+func (r *RedisLocker) extend(ctx context.Context, l *Lock, ttl time.Duration) error {
+	return r.run(ctx, extendScript, l, l.Token, ttl.Milliseconds())
+}
+
+func (r *RedisLocker) run(ctx context.Context, script *redis.Script, l *Lock, args ...interface{}) error {
+	ok, err := script.Run(ctx, r.client, []string{r.lockKey(l.Key)}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update lock %s: %w", l.Key, err)
+	}
+	if ok == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// lockKey wraps key in a hash tag, so a lock and its fence counter share a
+// slot on Redis Cluster
+func (r *RedisLocker) lockKey(key string) string {
+	return r.prefix + "{" + key + "}"
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheMetrics aggregates the latency of cache operations by name, and the
+// hits and misses of lookups. The zero value is ready to use.
+type CacheMetrics struct {
+	Hits   uint64
+	Misses uint64
+
+	mu         sync.RWMutex
+	operations map[string]*Operation
+}
+
+// Operation holds the counters of one kind of cache operation
+type Operation struct {
+	Count     uint64
+	Errors    uint64
+	TotalTime uint64 // nanoseconds
+}
+
+// TrackOperation records one run of the named operation
+func (m *CacheMetrics) TrackOperation(name string, duration time.Duration, err error) {
+	op := m.operation(name)
+	atomic.AddUint64(&op.Count, 1)
+	atomic.AddUint64(&op.TotalTime, uint64(duration))
+	if err != nil {
+		atomic.AddUint64(&op.Errors, 1)
+	}
+}
+
+// TrackLookups records the hits and misses of a lookup
+func (m *CacheMetrics) TrackLookups(hits, misses int) {
+	atomic.AddUint64(&m.Hits, uint64(hits))
+	atomic.AddUint64(&m.Misses, uint64(misses))
+}
+
+// HitRatio returns the share of lookups that were hits, or 0 before any
+func (m *CacheMetrics) HitRatio() float64 {
+	hits := atomic.LoadUint64(&m.Hits)
+	total := hits + atomic.LoadUint64(&m.Misses)
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// Operations returns a snapshot of the counters of each operation
+func (m *CacheMetrics) Operations() map[string]Operation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := make(map[string]Operation, len(m.operations))
+	for name, op := range m.operations {
+		snapshot[name] = Operation{
+			Count:     atomic.LoadUint64(&op.Count),
+			Errors:    atomic.LoadUint64(&op.Errors),
+			TotalTime: atomic.LoadUint64(&op.TotalTime),
+		}
+	}
+	return snapshot
+}
+
+// AverageTime returns the mean latency of the operation
+func (o Operation) AverageTime() time.Duration {
+	if o.Count == 0 {
+		return 0
+	}
+	return time.Duration(o.TotalTime / o.Count)
+}
+
+func (m *CacheMetrics) operation(name string) *Operation {
+	m.mu.RLock()
+	op, ok := m.operations[name]
+	m.mu.RUnlock()
+	if ok {
+		return op
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if op, ok = m.operations[name]; !ok {
+		if m.operations == nil {
+			m.operations = make(map[string]*Operation)
+		}
+		op = &Operation{}
+		m.operations[name] = op
+	}
+	return op
+}
@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority classifies requests for load shedding; lower priorities are shed
+// first
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+// Limit algorithms for the adaptive limiter
+const (
+	// AlgorithmAIMD grows the limit by one while latency is on target and
+	// cuts it multiplicatively when latency exceeds the target
+	AlgorithmAIMD = "aimd"
+	// AlgorithmGradient scales the limit by the ratio of the baseline
+	// latency to the current latency, in the style of TCP Vegas
+	AlgorithmGradient = "gradient"
+)
+
+type SheddingConfig struct {
+	// Algorithm is AlgorithmAIMD (default) or AlgorithmGradient
+	Algorithm string
+
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+
+	// TargetLatency is the latency above which the service is considered
+	// overloaded
+	TargetLatency time.Duration
+
+	// BackoffRatio is the AIMD multiplicative decrease, between 0 and 1
+	BackoffRatio float64
+
+	// Smoothing weights new gradient limits against the current limit,
+	// between 0 and 1
+	Smoothing float64
+
+	// PriorityFunc classifies a request; defaults to PriorityNormal
+	PriorityFunc func(*Context) Priority
+
+	// Shares is the fraction of the limit each priority may occupy.
+	// Defaults: low 0.5, normal 0.8, high 0.95, critical 1.
+	Shares map[Priority]float64
+
+	// RetryAfter is sent in the Retry-After header of shed requests.
+	// Defaults to the observed request latency, the time a slot takes to
+	// free up, rounded up to a whole second.
+	RetryAfter time.Duration
+
+	ErrorHandler func(*Context) error
+}
+
+// AdaptiveLimiter is a concurrency limiter whose limit adapts to observed
+// latency and which sheds low-priority requests first
+type AdaptiveLimiter struct {
+	config SheddingConfig
+
+	mu         sync.Mutex
+	limit      float64
+	inFlight   int
+	latency    float64 // short-term EWMA, nanoseconds
+	baseline   float64 // long-term EWMA, nanoseconds
+	overloaded bool
+	shed       map[Priority]uint64
+}
+
+// LimiterStats is a snapshot of an AdaptiveLimiter
+type LimiterStats struct {
+	Limit      int
+	InFlight   int
+	Latency    time.Duration
+	Overloaded bool
+	Shed       map[Priority]uint64
+}
+
+// NewAdaptiveLimiter creates a limiter, filling in defaults for zero values
+func NewAdaptiveLimiter(config SheddingConfig) *AdaptiveLimiter {
+	if config.Algorithm == "" {
+		config.Algorithm = AlgorithmAIMD
+	}
+	if config.MinLimit <= 0 {
+		config.MinLimit = 1
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = 1000
+	}
+	if config.InitialLimit <= 0 {
+		config.InitialLimit = 20
+	}
+	if config.TargetLatency <= 0 {
+		config.TargetLatency = 100 * time.Millisecond
+	}
+	if config.BackoffRatio <= 0 || config.BackoffRatio >= 1 {
+		config.BackoffRatio = 0.9
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = 0.2
+	}
+	if config.Shares == nil {
+		config.Shares = map[Priority]float64{
+			PriorityLow:      0.5,
+			PriorityNormal:   0.8,
+			PriorityHigh:     0.95,
+			PriorityCritical: 1,
+		}
+	}
+
+	return &AdaptiveLimiter{
+		config: config,
+		limit:  float64(config.InitialLimit),
+		shed:   make(map[Priority]uint64),
+	}
+}
+
+// NewSheddingMiddleware creates a middleware backed by a new AdaptiveLimiter
+func NewSheddingMiddleware(config SheddingConfig) MiddlewareFunc {
+	return NewAdaptiveLimiter(config).Middleware()
+}
+
+// Middleware rejects requests the limiter does not admit with 503
+func (l *AdaptiveLimiter) Middleware() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			priority := PriorityNormal
+			if l.config.PriorityFunc != nil {
+				priority = l.config.PriorityFunc(c)
+			}
+
+			if !l.Acquire(priority) {
+				if l.config.ErrorHandler != nil {
+					return l.config.ErrorHandler(c)
+				}
+				c.Response.Header().Set("Retry-After", l.retryAfter())
+				return c.JSON(http.StatusServiceUnavailable, Error{
+					Code:    "LOAD_SHED",
+					Message: "Service is overloaded, retry later",
+				})
+			}
+
+			// Deferred so a panicking handler still frees its slot
+			start := time.Now()
+			defer func() { l.Release(time.Since(start)) }()
+			return next(c)
+		}
+	}
+}
+
+// Acquire admits a request of the given priority if its share of the limit
+// is not used up. While overloaded, low-priority requests are always shed.
+func (l *AdaptiveLimiter) Acquire(priority Priority) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	allowed := l.limit * l.share(priority)
+	if l.overloaded && priority == PriorityLow {
+		allowed = 0
+	}
+	if float64(l.inFlight) >= allowed {
+		l.shed[priority]++
+		return false
+	}
+
+	l.inFlight++
+	return true
+}
+
+// Release records the latency of an admitted request and adapts the limit
+func (l *AdaptiveLimiter) Release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	sample := float64(latency)
+
+	if l.latency == 0 {
+		l.latency = sample
+		l.baseline = sample
+	} else {
+		l.latency = 0.8*l.latency + 0.2*sample
+		l.baseline = 0.99*l.baseline + 0.01*sample
+	}
+	l.overloaded = l.latency > float64(l.config.TargetLatency)
+
+	switch l.config.Algorithm {
+	case AlgorithmGradient:
+		l.updateGradient()
+	default:
+		l.updateAIMD(sample)
+	}
+}
+
+// updateAIMD adds one while the limit is in use and latency is on target,
+// and backs off multiplicatively on a slow request
+func (l *AdaptiveLimiter) updateAIMD(sample float64) {
+	if sample > float64(l.config.TargetLatency) {
+		l.setLimit(l.limit * l.config.BackoffRatio)
+	} else if float64(l.inFlight)*2 >= l.limit {
+		l.setLimit(l.limit + 1)
+	}
+}
+
+// updateGradient moves the limit towards limit * baseline / latency plus a
+// queue allowance of sqrt(limit), so the limit shrinks as latency rises
+// above the long-term baseline
+func (l *AdaptiveLimiter) updateGradient() {
+	gradient := 1.0
+	if l.latency > 0 {
+		gradient = math.Max(0.5, math.Min(1, l.baseline/l.latency))
+	}
+	if l.overloaded {
+		// Over target regardless of the baseline: do not grow
+		gradient = math.Min(gradient, 0.9)
+	}
+
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-l.config.Smoothing) + target*l.config.Smoothing)
+}
+
+// retryAfter returns the Retry-After value for a shed request, in seconds
+func (l *AdaptiveLimiter) retryAfter() string {
+	wait := l.config.RetryAfter
+	if wait <= 0 {
+		l.mu.Lock()
+		wait = time.Duration(l.latency)
+		l.mu.Unlock()
+	}
+	return strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds()))))
+}
+
+func (l *AdaptiveLimiter) setLimit(limit float64) {
+	l.limit = math.Max(float64(l.config.MinLimit), math.Min(float64(l.config.MaxLimit), limit))
+}
+
+func (l *AdaptiveLimiter) share(priority Priority) float64 {
+	if share, ok := l.config.Shares[priority]; ok {
+		return share
+	}
+	return 1
+}
+
+// Stats returns a snapshot of the limiter
+func (l *AdaptiveLimiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	shed := make(map[Priority]uint64, len(l.shed))
+	for p, n := range l.shed {
+		shed[p] = n
+	}
+	return LimiterStats{
+		Limit:      int(l.limit),
+		InFlight:   l.inFlight,
+		Latency:    time.Duration(l.latency),
+		Overloaded: l.overloaded,
+		Shed:       shed,
+	}
+}
+
+// PriorityByPath classifies requests by the longest matching path prefix,
+// e.g. {"/callbacks/payments": PriorityCritical, "/reports": PriorityLow}
+func PriorityByPath(prefixes map[string]Priority, fallback Priority) func(*Context) Priority {
+	return func(c *Context) Priority {
+		best, priority := -1, fallback
+		for prefix, p := range prefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) && len(prefix) > best {
+				best, priority = len(prefix), p
+			}
+		}
+		return priority
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"neuron/pkg/router"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter_PriorityShares(t *testing.T) {
+	// With a limit of 20: low may use 10 slots, normal 16, high 19, critical 20
+	l := NewAdaptiveLimiter(SheddingConfig{InitialLimit: 20, MinLimit: 20, MaxLimit: 20})
+
+	steps := []struct {
+		priority Priority
+		admitted int
+	}{
+		{priority: PriorityLow, admitted: 10},
+		{priority: PriorityNormal, admitted: 6},
+		{priority: PriorityHigh, admitted: 3},
+		{priority: PriorityCritical, admitted: 1},
+	}
+
+	for _, step := range steps {
+		for i := 0; i < step.admitted; i++ {
+			if !l.Acquire(step.priority) {
+				t.Fatalf("Acquire(%d) #%d rejected within its share", step.priority, i)
+			}
+		}
+		if l.Acquire(step.priority) {
+			t.Errorf("Acquire(%d) admitted beyond its share", step.priority)
+		}
+	}
+}
+
+func TestAdaptiveLimiter_Adapts(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+	}{
+		{name: "aimd", algorithm: AlgorithmAIMD},
+		{name: "gradient", algorithm: AlgorithmGradient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewAdaptiveLimiter(SheddingConfig{
+				Algorithm:     tt.algorithm,
+				InitialLimit:  20,
+				TargetLatency: 50 * time.Millisecond,
+			})
+
+			// Fast requests under load grow the limit
+			for i := 0; i < 50; i++ {
+				for j := 0; j < 15; j++ {
+					l.Acquire(PriorityCritical)
+				}
+				for j := 0; j < 15; j++ {
+					l.Release(10 * time.Millisecond)
+				}
+			}
+			grown := l.Stats().Limit
+			if grown <= 20 {
+				t.Fatalf("limit after fast requests = %d, want > 20", grown)
+			}
+
+			// Slow requests shrink it and mark the limiter overloaded
+			for i := 0; i < 50; i++ {
+				l.Acquire(PriorityCritical)
+				l.Release(500 * time.Millisecond)
+			}
+			stats := l.Stats()
+			if stats.Limit >= grown || !stats.Overloaded {
+				t.Errorf("after slow requests stats = %+v, want limit < %d and overloaded", stats, grown)
+			}
+			if l.Acquire(PriorityLow) {
+				t.Error("Acquire(low) admitted while overloaded")
+			}
+		})
+	}
+}
+
+func TestSheddingMiddleware(t *testing.T) {
+	mw := NewSheddingMiddleware(SheddingConfig{
+		InitialLimit: 1,
+		MaxLimit:     1,
+		PriorityFunc: PriorityByPath(map[string]Priority{
+			"/reports":  PriorityLow,
+			"/callback": PriorityCritical,
+		}, PriorityNormal),
+	})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := mw(func(c *Context) error {
+		if c.Request.URL.Path == "/callback/slow" {
+			close(started)
+			<-release
+		}
+		return c.String(http.StatusOK, "OK")
+	})
+
+	go handler(router.NewContext(httptest.NewRequest(http.MethodGet, "/callback/slow", nil), httptest.NewRecorder()))
+	<-started
+
+	rec := httptest.NewRecorder()
+	if err := handler(router.NewContext(httptest.NewRequest(http.MethodGet, "/reports/daily", nil), rec)); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("shed response = %d, want 503 with Retry-After", rec.Code)
+	}
+	close(release)
+}
+
+func TestAdaptiveLimiter_PanicReleasesSlot(t *testing.T) {
+	l := NewAdaptiveLimiter(SheddingConfig{InitialLimit: 1, MinLimit: 1, MaxLimit: 1})
+	handler := l.Middleware()(func(c *Context) error {
+		panic("boom")
+	})
+
+	for i := 0; i < 3; i++ {
+		func() {
+			// Stands in for the recovery middleware
+			defer func() { recover() }()
+			handler(router.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+		}()
+	}
+
+	if stats := l.Stats(); stats.InFlight != 0 || len(stats.Shed) != 0 {
+		t.Errorf("Stats() after panics = %+v, want no requests in flight or shed", stats)
+	}
+}
+
+func TestAdaptiveLimiter_RetryAfter(t *testing.T) {
+	tests := []struct {
+		config  SheddingConfig
+		latency time.Duration
+		want    string
+	}{
+		{SheddingConfig{}, 0, "1"},
+		{SheddingConfig{}, 200 * time.Millisecond, "1"},
+		{SheddingConfig{}, 2500 * time.Millisecond, "3"},
+		{SheddingConfig{RetryAfter: 10 * time.Second}, 2500 * time.Millisecond, "10"},
+	}
+
+	for _, tt := range tests {
+		l := NewAdaptiveLimiter(tt.config)
+		if tt.latency > 0 {
+			l.Acquire(PriorityCritical)
+			l.Release(tt.latency)
+		}
+		if got := l.retryAfter(); got != tt.want {
+			t.Errorf("retryAfter() with %v latency = %s, want %s", tt.latency, got, tt.want)
+		}
+	}
+}
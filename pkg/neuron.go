@@ -4,11 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/pprof"
+	"neuron/pkg/cache"
+	"neuron/pkg/config"
+	"neuron/pkg/event"
+	"neuron/pkg/health"
 	"neuron/pkg/router"
+	"neuron/pkg/server"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +27,23 @@ type EngineConfig struct {
 	QueueSize        int
 	GracefulShutdown bool
 	ShutdownTimeout  time.Duration
+	// DrainPeriod is how long the engine keeps serving after readiness
+	// starts failing, so load balancers stop routing to it before the
+	// listener closes
+	DrainPeriod time.Duration
+
+	// ZeroDowntimeRestart re-executes the binary on SIGHUP or SIGUSR2, hands
+	// the listening socket to the new process and drains this one once the
+	// new process is ready. RestartTimeout bounds the wait for readiness.
+	ZeroDowntimeRestart bool
+	RestartTimeout      time.Duration
+
+	// ModuleInitTimeout bounds the Init of each module; zero means no limit
+	ModuleInitTimeout time.Duration
+
+	// Health check settings for /healthz and /readyz
+	HealthCheckTimeout time.Duration
+	HealthCacheTTL     time.Duration
 
 	// Performance settings
 	EnableCompression bool
@@ -32,6 +56,15 @@ type EngineConfig struct {
 	EnableSecureSession bool
 	EnableRateLimit     bool
 
+	// AdmissionControl caps in-flight requests at WorkerPoolSize and queues
+	// up to QueueSize more for at most QueueTimeout, or until the client
+	// goes away when QueueTimeout is zero. Requests beyond that get 503 with
+	// a Retry-After of RetryAfter. Requests run on their own goroutines; the
+	// limit only shares its size with the WorkerPool.
+	AdmissionControl bool
+	QueueTimeout     time.Duration
+	RetryAfter       time.Duration
+
 	// HTTP Server settings
 	Host           string
 	Port           int
@@ -39,37 +72,78 @@ type EngineConfig struct {
 	WriteTimeout   time.Duration
 	IdleTimeout    time.Duration
 	MaxHeaderBytes int
+
+	// TLS settings; when enabled the engine serves HTTPS only
+	TLS config.TLSConfig
+
+	// HTTP/2 settings; H2C enables cleartext HTTP/2 when TLS is disabled
+	HTTP2 config.HTTP2Config
 }
 
 // Engine is the core of the Neuron framework
 type Engine struct {
 	config       *EngineConfig
 	modules      *ModuleRegistry
+	container    *Container
+	health       *health.Registry
+	events       *event.Bus
 	router       *router.Router
 	pool         *WorkerPool
-	cache        Cache
+	cache        *cache.Module
 	metrics      *MetricsCollector
 	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	shutdownErr  error
+	ready        atomic.Bool
+	inFlight     atomic.Int64
 	wg           sync.WaitGroup
+	errs         chan error
+	cancelRun    context.CancelFunc
 	server       *http.Server
-	requestQueue chan *http.Request
-	workerPool   *WorkerPool
+	listener     net.Listener
+	restarted    chan struct{}
+	restarting   atomic.Bool
+	admission    *admission
 }
 
 // New creates a new Neuron engine instance with the provided configuration
 func New(config *EngineConfig) *Engine {
-	return &Engine{
-		config:   config,
-		modules:  NewModuleRegistry(),
-		router:   router.New(),
-		shutdown: make(chan struct{}),
+	e := &Engine{
+		config:    config,
+		modules:   NewModuleRegistry(),
+		container: NewContainer(),
+		metrics:   &MetricsCollector{},
+		router:    router.New(),
+		shutdown:  make(chan struct{}),
+		restarted: make(chan struct{}),
+		errs:      make(chan error, 1),
 	}
+	e.health = health.NewRegistry(health.Options{
+		Timeout:  config.HealthCheckTimeout,
+		CacheTTL: config.HealthCacheTTL,
+		Ready:    e.Ready,
+	})
+	e.events = event.NewBus(event.Options{
+		OnError: func(evt event.Event, subscriber string, err error) {
+			log.Printf("Event %s subscriber %s failed: %v", evt.Topic, subscriber, err)
+		},
+	})
+
+	// Framework services are injectable by type
+	ProvideValue(e.container, e)
+	ProvideValue(e.container, e.router.Logger)
+	ProvideValue(e.container, e.events)
+
+	return e
 }
 
 // ModuleRegistry manages framework modules
 type ModuleRegistry struct {
-	modules map[string]Module
-	mu      sync.RWMutex
+	modules     map[string]Module
+	order       []string // registration order
+	started     []string // initialization order of running modules
+	initTimeout time.Duration
+	mu          sync.RWMutex
 }
 
 // Module interface for extensible components
@@ -79,24 +153,6 @@ type Module interface {
 	Shutdown(ctx context.Context) error
 }
 
-// WorkerPool manages goroutines for request handling
-type WorkerPool struct {
-	workers chan *Worker
-	queue   chan Job
-	size    int
-}
-
-// Worker represents a worker in the pool
-type Worker struct {
-	id     int
-	engine *Engine
-}
-
-// Job represents a unit of work
-type Job struct {
-	Handler func() error
-}
-
 // Cache interface for the caching system
 type Cache interface {
 	Get(key string) (interface{}, error)
@@ -106,7 +162,10 @@ type Cache interface {
 
 // MetricsCollector for monitoring and metrics
 type MetricsCollector struct {
-	// Add metrics fields
+	queued        atomic.Int64
+	admitted      atomic.Uint64
+	rejected      atomic.Uint64
+	queueTimeouts atomic.Uint64
 }
 
 // NewModuleRegistry creates a new module registry
@@ -127,6 +186,7 @@ func (mr *ModuleRegistry) RegisterModule(module Module) error {
 	}
 
 	mr.modules[name] = module
+	mr.order = append(mr.order, name)
 	return nil
 }
 
@@ -143,31 +203,79 @@ func (mr *ModuleRegistry) GetModule(name string) (Module, error) {
 	return module, nil
 }
 
-// InitializeModules initializes all registered modules
-func (mr *ModuleRegistry) InitializeModules(ctx context.Context) error {
+// running returns the initialized modules in initialization order
+func (mr *ModuleRegistry) running() []Module {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	modules := make([]Module, 0, len(mr.started))
+	for _, name := range mr.started {
+		modules = append(modules, mr.modules[name])
+	}
+	return modules
+}
+
+// SetInitTimeout bounds how long each module's Init may take; zero means no
+// limit
+func (mr *ModuleRegistry) SetInitTimeout(timeout time.Duration) {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
+	mr.initTimeout = timeout
+}
 
-	for name, module := range mr.modules {
-		if err := module.Init(ctx); err != nil {
-			return fmt.Errorf("failed to initialize module %s: %w", name, err)
+// InitializeModules initializes all registered modules in dependency order.
+// If a module fails to initialize, the modules already started are shut down
+// in reverse order and the error is returned.
+func (mr *ModuleRegistry) InitializeModules(ctx context.Context) error {
+	mr.mu.RLock()
+	order, err := mr.resolveOrder()
+	timeout := mr.initTimeout
+	mr.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Init runs without holding the lock so modules can look up their
+	// dependencies with GetModule
+	var started []string
+	for _, module := range order {
+		if err := initModule(ctx, module, timeout); err != nil {
+			mr.rollback(ctx, order[:len(started)])
+			return fmt.Errorf("failed to initialize module %s: %w", module.Name(), err)
 		}
+		started = append(started, module.Name())
 	}
 
+	mr.mu.Lock()
+	mr.started = started
+	mr.mu.Unlock()
+
 	return nil
 }
 
-// ShutdownModules gracefully shuts down all modules
+// rollback shuts down already started modules after a failed initialization
+func (mr *ModuleRegistry) rollback(ctx context.Context, started []Module) {
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := started[i].Shutdown(ctx); err != nil {
+			log.Printf("Failed to roll back module %s: %v", started[i].Name(), err)
+		}
+	}
+}
+
+// ShutdownModules gracefully shuts down the initialized modules in reverse
+// initialization order, so a module stops before the modules it depends on
 func (mr *ModuleRegistry) ShutdownModules(ctx context.Context) error {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
 
 	var errs []error
-	for name, module := range mr.modules {
-		if err := module.Shutdown(ctx); err != nil {
+	for i := len(mr.started) - 1; i >= 0; i-- {
+		name := mr.started[i]
+		if err := mr.modules[name].Shutdown(ctx); err != nil {
 			errs = append(errs, fmt.Errorf("failed to shutdown module %s: %w", name, err))
 		}
 	}
+	mr.started = nil
 
 	if len(errs) > 0 {
 		return fmt.Errorf("module shutdown errors: %v", errs)
@@ -186,15 +294,27 @@ func (e *Engine) Start() error {
 	// Initialize worker pool
 	if e.config.WorkerPoolSize > 0 {
 		e.pool = NewWorkerPool(e.config.WorkerPoolSize)
+		ProvideValue(e.container, e.pool)
+		e.events.SetExecutor(poolExecutor{e.pool})
+	}
+
+	// Initialize admission control
+	if e.config.AdmissionControl && e.config.WorkerPoolSize > 0 {
+		e.admission = newAdmission(e.config.WorkerPoolSize, e.config.QueueSize, e.config.QueueTimeout, e.metrics)
 	}
 
+	e.modules.SetInitTimeout(e.config.ModuleInitTimeout)
+
 	// Ensure router exists
 	if e.router == nil {
 		e.router = router.New()
 	}
 
-	// Enable profiling endpoints
+	// Enable profiling and metrics endpoints
 	e.enableProfiling()
+	e.router.GET("/debug/metrics", func(c *router.Context) error {
+		return c.JSON(http.StatusOK, e.Metrics())
+	})
 
 	// Initialize modules
 	ctx := context.Background()
@@ -202,6 +322,25 @@ func (e *Engine) Start() error {
 		return fmt.Errorf("failed to initialize modules: %w", err)
 	}
 
+	// Shut the initialized modules down again if any later step fails
+	started := false
+	defer func() {
+		if started {
+			return
+		}
+		if err := e.modules.ShutdownModules(ctx); err != nil {
+			log.Printf("Failed to roll back modules: %v", err)
+		}
+	}()
+
+	// Build singletons now so a missing dependency fails startup rather
+	// than the first request that needs it
+	if err := e.container.Validate(); err != nil {
+		return fmt.Errorf("dependency injection: %w", err)
+	}
+
+	e.enableHealth()
+
 	// Configure HTTP server
 	addr := fmt.Sprintf("%s:%d", e.config.Host, e.config.Port)
 	e.server = &http.Server{
@@ -213,46 +352,59 @@ func (e *Engine) Start() error {
 		MaxHeaderBytes: e.config.MaxHeaderBytes,
 	}
 
+	if e.config.TLS.Enabled {
+		tlsConfig, err := server.NewTLSConfig(e.config.TLS, e.router.Logger)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		e.server.TLSConfig = tlsConfig
+	}
+
+	h2Config := e.config.HTTP2
+	if e.config.TLS.Enabled {
+		h2Config.H2C = false
+	}
+	if err := server.ConfigureHTTP2(e.server, h2Config); err != nil {
+		return fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+
+	// Bind the listener, reusing one handed over by a parent process
+	ln, err := e.listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	e.listener = ln
+
 	// Start HTTP server in a goroutine
 	e.wg.Add(1)
 	go func() {
 		defer e.wg.Done()
-		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
+		var err error
+		if e.config.TLS.Enabled {
+			// Certificates come from TLSConfig.GetCertificate
+			err = e.server.ServeTLS(ln, "", "")
+		} else {
+			err = e.server.Serve(ln)
 		}
-	}()
-
-	log.Printf("Server started on %s", addr)
-	return nil
-}
-
-// Shutdown gracefully shuts down the engine
-func (e *Engine) Shutdown(ctx context.Context) error {
-	// Signal shutdown
-	close(e.shutdown)
-
-	// Shutdown HTTP server
-	if e.server != nil {
-		if err := e.server.Shutdown(ctx); err != nil {
-			return fmt.Errorf("failed to shutdown HTTP server: %w", err)
+		if err != nil && err != http.ErrServerClosed {
+			e.fail(fmt.Errorf("HTTP server error: %w", err))
 		}
-	}
+	}()
 
-	// Shutdown worker pool if it exists
-	if e.pool != nil {
-		if err := e.pool.Shutdown(ctx); err != nil {
-			return fmt.Errorf("failed to shutdown worker pool: %w", err)
-		}
+	// Tell a parent process waiting on a restart that we are serving
+	if err := notifyReady(); err != nil {
+		log.Printf("Failed to notify parent process: %v", err)
 	}
 
-	// Shutdown modules
-	if err := e.modules.ShutdownModules(ctx); err != nil {
-		return fmt.Errorf("failed to shutdown modules: %w", err)
+	if e.config.ZeroDowntimeRestart {
+		e.watchRestartSignals()
 	}
 
-	// Wait for all goroutines to finish
-	e.wg.Wait()
+	e.startRunners()
 
+	started = true
+	e.ready.Store(true)
+	log.Printf("Server started on %s", addr)
 	return nil
 }
 
@@ -266,116 +418,43 @@ func (e *Engine) GetModule(name string) (Module, error) {
 	return e.modules.GetModule(name)
 }
 
-// NewWorkerPool creates a new worker pool with the specified size
-func NewWorkerPool(size int) *WorkerPool {
-	pool := &WorkerPool{
-		workers: make(chan *Worker, size),
-		queue:   make(chan Job, size*100), // Buffer for pending jobs
-		size:    size,
-	}
-
-	// Initialize workers
-	for i := 0; i < size; i++ {
-		worker := &Worker{
-			id: i,
-		}
-		pool.workers <- worker
-		go pool.startWorker(worker)
-	}
-
-	return pool
-}
-
-// Submit adds a new job to the worker pool
-func (p *WorkerPool) Submit(job Job) error {
-	select {
-	case p.queue <- job:
-		return nil
-	default:
-		return fmt.Errorf("worker pool queue is full")
-	}
-}
-
-// startWorker starts a worker's processing loop
-func (p *WorkerPool) startWorker(w *Worker) {
-	for job := range p.queue {
-		// Execute the job
-		if err := job.Handler(); err != nil {
-			// TODO: Implement error handling strategy
-			// Could be logging, metrics, retry logic, etc.
-			continue
-		}
-
-		// Return worker to pool
-		p.workers <- w
-	}
-}
-
-// Shutdown gracefully shuts down the worker pool
-func (p *WorkerPool) Shutdown(ctx context.Context) error {
-	// Close job queue to stop accepting new jobs
-	close(p.queue)
-
-	// Wait for remaining jobs to complete with timeout
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-		// Wait for all workers to finish
-		for i := 0; i < p.size; i++ {
-			<-p.workers
-		}
-		close(p.workers)
-		return nil
-	}
-}
-
-// Stats returns current worker pool statistics
-type WorkerStats struct {
-	TotalWorkers int
-	ActiveJobs   int
-	QueuedJobs   int
-}
-
-// Stats returns current statistics about the worker pool
-func (p *WorkerPool) Stats() WorkerStats {
-	return WorkerStats{
-		TotalWorkers: p.size,
-		ActiveJobs:   p.size - len(p.workers),
-		QueuedJobs:   len(p.queue),
-	}
-}
-
 // Add default configuration helper
 func DefaultConfig() *EngineConfig {
 	return &EngineConfig{
-		Host:             "localhost",
-		Port:             8080,
-		MaxProcs:         runtime.NumCPU(),
-		WorkerPoolSize:   100,
-		QueueSize:        1000,
-		ReadTimeout:      time.Second * 30,
-		WriteTimeout:     time.Second * 30,
-		IdleTimeout:      time.Second * 60,
-		MaxHeaderBytes:   1 << 20, // 1MB
-		GracefulShutdown: true,
-		ShutdownTimeout:  time.Second * 30,
+		Host:               "localhost",
+		Port:               8080,
+		MaxProcs:           runtime.NumCPU(),
+		WorkerPoolSize:     100,
+		QueueSize:          1000,
+		QueueTimeout:       time.Second,
+		RetryAfter:         time.Second,
+		ReadTimeout:        time.Second * 30,
+		WriteTimeout:       time.Second * 30,
+		IdleTimeout:        time.Second * 60,
+		MaxHeaderBytes:     1 << 20, // 1MB
+		GracefulShutdown:   true,
+		ShutdownTimeout:    time.Second * 30,
+		RestartTimeout:     time.Second * 30,
+		HealthCheckTimeout: time.Second * 2,
+		HealthCacheTTL:     time.Second,
 	}
 }
 
 // ServeHTTP implements the http.Handler interface
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Queue request or handle directly based on load
-	if e.requestQueue != nil {
-		select {
-		case e.requestQueue <- r:
-			// Request queued
-		default:
-			// Queue full, handle directly
-			e.router.ServeHTTP(w, r)
+	e.inFlight.Add(1)
+	defer e.inFlight.Add(-1)
+
+	// Bound concurrency; health probes bypass admission so a saturated
+	// engine is not restarted by its liveness probe
+	if e.admission != nil && !isHealthPath(r.URL.Path) {
+		if err := e.admission.acquire(r.Context()); err != nil {
+			e.reject(w, err)
+			return
 		}
-		return
+		defer e.admission.release()
 	}
+
 	e.router.ServeHTTP(w, r)
 }
 
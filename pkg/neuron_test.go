@@ -0,0 +1,613 @@
+package neuron
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"neuron/pkg/router"
+)
+
+func TestWorkerPool_ShutdownWaitsForJobs(t *testing.T) {
+	pool := NewWorkerPool(2)
+
+	var done int32
+	for i := 0; i < 10; i++ {
+		err := pool.Submit(Job{Handler: func() error {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+			return nil
+		}})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&done); got != 10 {
+		t.Errorf("completed jobs = %d, want 10", got)
+	}
+	if err := pool.Submit(Job{Handler: func() error { return nil }}); err == nil {
+		t.Error("Submit() after Shutdown succeeded, want error")
+	}
+}
+
+func TestWorkerPool_ShutdownTimeout(t *testing.T) {
+	pool := NewWorkerPool(1)
+	release := make(chan struct{})
+	defer close(release)
+
+	pool.Submit(Job{Handler: func() error {
+		<-release
+		return nil
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWorkerPool_ShutdownWithBlockedSubmit(t *testing.T) {
+	pool := NewWorkerPoolWithConfig(WorkerPoolConfig{Size: 1, QueueSize: 1})
+	release := make(chan struct{})
+	defer close(release)
+
+	// One job runs and one fills the queue, so SubmitWait blocks
+	started := make(chan struct{}, 2)
+	block := Job{Handler: func() error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}}
+	pool.Submit(block)
+	<-started
+	if err := pool.Submit(block); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- pool.SubmitWait(context.Background(), Job{Handler: func() error { return nil }})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown() took %v, want it to honour its deadline", elapsed)
+	}
+
+	select {
+	case err := <-submitted:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("SubmitWait() error = %v, want ErrPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("SubmitWait() still blocked after Shutdown()")
+	}
+	if stats := pool.Stats(); stats.QueuedJobs != 1 {
+		t.Errorf("Stats() = %+v, want 1 queued job", stats)
+	}
+}
+
+func TestWorkerPool_Retries(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		name      string
+		fails     int
+		err       error
+		policy    RetryPolicy
+		wantErr   error
+		wantCalls int32
+	}{
+		{"no retry", 1, errFlaky, RetryPolicy{}, errFlaky, 1},
+		{"succeeds on retry", 2, errFlaky, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, nil, 3},
+		{"attempts exhausted", 5, errFlaky, RetryPolicy{MaxAttempts: 3}, errFlaky, 3},
+		{"not retryable", 5, errFatal, RetryPolicy{
+			MaxAttempts: 3,
+			Retryable:   func(err error) bool { return !errors.Is(err, errFatal) },
+		}, errFatal, 1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dead := make(chan FailedJob, 1)
+			pool := NewWorkerPoolWithConfig(WorkerPoolConfig{Size: 1, DeadLetter: dead})
+			defer pool.Shutdown(context.Background())
+
+			var calls int32
+			err := pool.SubmitWait(context.Background(), Job{
+				Name:  "flaky",
+				Retry: tt.policy,
+				Handler: func() error {
+					if atomic.AddInt32(&calls, 1) <= int32(tt.fails) {
+						return tt.err
+					}
+					return nil
+				},
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SubmitWait() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr != nil {
+				failed := <-dead
+				if failed.Job.Name != "flaky" || int32(failed.Attempts) != tt.wantCalls {
+					t.Errorf("dead letter = %+v, want job flaky after %d attempts", failed, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerPool_PanicRecovery(t *testing.T) {
+	var reported atomic.Value
+	pool := NewWorkerPoolWithConfig(WorkerPoolConfig{
+		Size:    1,
+		OnError: func(f FailedJob) { reported.Store(f) },
+	})
+
+	err := pool.SubmitWait(context.Background(), Job{Handler: func() error { panic("boom") }})
+	var perr *PanicError
+	if !errors.As(err, &perr) || perr.Value != "boom" {
+		t.Fatalf("SubmitWait() error = %v, want PanicError(boom)", err)
+	}
+	if _, ok := reported.Load().(FailedJob); !ok {
+		t.Error("OnError was not called")
+	}
+
+	// The worker survives the panic
+	if err := pool.SubmitWait(context.Background(), Job{Handler: func() error { return nil }}); err != nil {
+		t.Fatalf("SubmitWait() after panic error = %v", err)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	stats := pool.Stats()
+	want := WorkerStats{TotalWorkers: 1, CompletedJobs: 1, FailedJobs: 1, PanickedJobs: 1}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestSubmitFunc(t *testing.T) {
+	pool := NewWorkerPool(2)
+	defer pool.Shutdown(context.Background())
+
+	future, err := SubmitFunc(context.Background(), pool, func() (int, error) { return 42, nil })
+	if err != nil {
+		t.Fatalf("SubmitFunc() error = %v", err)
+	}
+	got, err := future.Wait(context.Background())
+	if err != nil || got != 42 {
+		t.Errorf("Wait() = %d, %v, want 42, nil", got, err)
+	}
+}
+
+type recordingModule struct {
+	name string
+	log  *[]string
+}
+
+func (m *recordingModule) Init(ctx context.Context) error {
+	*m.log = append(*m.log, "init:"+m.name)
+	return nil
+}
+
+func (m *recordingModule) Name() string { return m.name }
+
+func (m *recordingModule) Shutdown(ctx context.Context) error {
+	*m.log = append(*m.log, "shutdown:"+m.name)
+	return nil
+}
+
+func TestEngine_ShutdownIdempotent(t *testing.T) {
+	var events []string
+	e := New(&EngineConfig{GracefulShutdown: true})
+	e.RegisterModule(&recordingModule{name: "a", log: &events})
+	e.RegisterModule(&recordingModule{name: "b", log: &events})
+	if err := e.modules.InitializeModules(context.Background()); err != nil {
+		t.Fatalf("InitializeModules() error = %v", err)
+	}
+	events = nil
+
+	for i := 0; i < 2; i++ {
+		if err := e.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown() error = %v", err)
+		}
+	}
+
+	want := []string{"shutdown:b", "shutdown:a"}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("events = %v, want %v", events, want)
+			break
+		}
+	}
+	if e.Ready() {
+		t.Error("Ready() = true after Shutdown")
+	}
+}
+
+func TestEngine_StartRollsBackModules(t *testing.T) {
+	var events []string
+	config := &EngineConfig{Host: "127.0.0.1"}
+	config.TLS.Enabled = true
+	config.TLS.CertFile = "testdata/missing.pem"
+	config.TLS.KeyFile = "testdata/missing.key"
+
+	e := New(config)
+	e.RegisterModule(&recordingModule{name: "db", log: &events})
+
+	if err := e.Start(); err == nil {
+		t.Fatal("Start() with missing certificate succeeded, want error")
+	}
+	if len(events) != 2 || events[1] != "shutdown:db" {
+		t.Errorf("events = %v, want init then shutdown", events)
+	}
+}
+
+func TestEngine_StartRollsBackOnListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer taken.Close()
+
+	var events []string
+	e := New(&EngineConfig{Host: "127.0.0.1", Port: taken.Addr().(*net.TCPAddr).Port})
+	e.RegisterModule(&recordingModule{name: "db", log: &events})
+
+	if err := e.Start(); err == nil {
+		t.Fatal("Start() on a port in use succeeded, want error")
+	}
+	if len(events) != 2 || events[1] != "shutdown:db" {
+		t.Errorf("events = %v, want init then shutdown", events)
+	}
+}
+
+type ctxModule struct {
+	recordingModule
+	err error
+}
+
+func (m *ctxModule) Shutdown(ctx context.Context) error {
+	m.err = ctx.Err()
+	return nil
+}
+
+func TestEngine_ShutdownModulesAfterDeadline(t *testing.T) {
+	var events []string
+	e := New(&EngineConfig{GracefulShutdown: true, ShutdownTimeout: time.Second})
+	m := &ctxModule{recordingModule: recordingModule{name: "db", log: &events}}
+	e.RegisterModule(m)
+	if err := e.modules.InitializeModules(context.Background()); err != nil {
+		t.Fatalf("InitializeModules() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e.Shutdown(ctx)
+	if m.err != nil {
+		t.Errorf("module Shutdown got ctx error %v, want a live context", m.err)
+	}
+}
+
+type failingRunner struct {
+	recordingModule
+	err error
+}
+
+func (m *failingRunner) Run(ctx context.Context) error {
+	return m.err
+}
+
+func TestEngine_RunReturnsModuleError(t *testing.T) {
+	var events []string
+	wantErr := errors.New("consumer lost connection")
+
+	e := New(&EngineConfig{Host: "127.0.0.1", GracefulShutdown: true, ShutdownTimeout: time.Second})
+	e.RegisterModule(&failingRunner{recordingModule: recordingModule{name: "consumer", log: &events}, err: wantErr})
+
+	err := e.Run(context.Background())
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Run() error = %v, want %v", err, wantErr)
+	}
+	if len(events) != 2 || events[1] != "shutdown:consumer" {
+		t.Errorf("events = %v, want init then shutdown", events)
+	}
+}
+
+func TestEngine_RunStopsOnCancel(t *testing.T) {
+	e := New(&EngineConfig{Host: "127.0.0.1", GracefulShutdown: true, ShutdownTimeout: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for !e.Ready() {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	if err := e.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestEngine_RunStartFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer taken.Close()
+
+	var events []string
+	e := New(&EngineConfig{Host: "127.0.0.1", Port: taken.Addr().(*net.TCPAddr).Port})
+	e.RegisterModule(&recordingModule{name: "db", log: &events})
+
+	if err := e.Run(context.Background()); err == nil {
+		t.Fatal("Run() on a port in use succeeded, want error")
+	}
+	if len(events) != 2 || events[1] != "shutdown:db" {
+		t.Errorf("events = %v, want init then shutdown", events)
+	}
+}
+
+func TestEngine_ShutdownContext(t *testing.T) {
+	tests := []struct {
+		config EngineConfig
+		want   time.Duration
+	}{
+		{EngineConfig{}, defaultShutdownTimeout},
+		{EngineConfig{ShutdownTimeout: 5 * time.Second}, 5 * time.Second},
+		{EngineConfig{ShutdownTimeout: 5 * time.Second, GracefulShutdown: true, DrainPeriod: 2 * time.Second}, 7 * time.Second},
+	}
+
+	for _, tt := range tests {
+		config := tt.config
+		ctx, cancel := New(&config).shutdownContext()
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if remaining := time.Until(deadline); !ok || remaining > tt.want || remaining < tt.want-time.Second {
+			t.Errorf("shutdownContext() with %+v expires in %v, want %v", tt.config, remaining, tt.want)
+		}
+	}
+}
+
+type dependentModule struct {
+	recordingModule
+	deps    []string
+	initErr error
+}
+
+func (m *dependentModule) DependsOn() []string { return m.deps }
+
+func (m *dependentModule) Init(ctx context.Context) error {
+	if m.initErr != nil {
+		return m.initErr
+	}
+	return m.recordingModule.Init(ctx)
+}
+
+type moduleSpec struct {
+	name    string
+	deps    []string
+	initErr error
+}
+
+func TestModuleRegistry_DependencyOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		modules    []moduleSpec
+		wantEvents []string
+		wantErr    string
+	}{
+		{
+			name: "dependencies first",
+			modules: []moduleSpec{
+				{name: "api", deps: []string{"cache", "db"}},
+				{name: "cache", deps: []string{"db"}},
+				{name: "db"},
+				{name: "metrics"},
+			},
+			wantEvents: []string{"init:db", "init:cache", "init:api", "init:metrics"},
+		},
+		{
+			name: "missing dependency",
+			modules: []moduleSpec{
+				{name: "api", deps: []string{"cache"}},
+			},
+			wantErr: "module api depends on unknown module cache",
+		},
+		{
+			name: "cycle",
+			modules: []moduleSpec{
+				{name: "a", deps: []string{"b"}},
+				{name: "b", deps: []string{"c"}},
+				{name: "c", deps: []string{"a"}},
+			},
+			wantErr: "module dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name: "rollback on failure",
+			modules: []moduleSpec{
+				{name: "db"},
+				{name: "cache", deps: []string{"db"}},
+				{name: "api", deps: []string{"cache"}, initErr: errors.New("boom")},
+			},
+			wantEvents: []string{"init:db", "init:cache", "shutdown:cache", "shutdown:db"},
+			wantErr:    "failed to initialize module api: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []string
+			mr := NewModuleRegistry()
+			for _, m := range tt.modules {
+				mr.RegisterModule(&dependentModule{
+					recordingModule: recordingModule{name: m.name, log: &events},
+					deps:            m.deps,
+					initErr:         m.initErr,
+				})
+			}
+
+			err := mr.InitializeModules(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("InitializeModules() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("InitializeModules() error = %v", err)
+			}
+
+			if len(events) != len(tt.wantEvents) {
+				t.Fatalf("events = %v, want %v", events, tt.wantEvents)
+			}
+			for i := range events {
+				if events[i] != tt.wantEvents[i] {
+					t.Fatalf("events = %v, want %v", events, tt.wantEvents)
+				}
+			}
+		})
+	}
+}
+
+type slowModule struct {
+	release  chan struct{}
+	shutdown chan struct{}
+}
+
+func (m *slowModule) Init(ctx context.Context) error {
+	// Ignores ctx, like a client with its own connect timeout
+	<-m.release
+	return nil
+}
+
+func (m *slowModule) Name() string { return "slow" }
+
+func (m *slowModule) Shutdown(ctx context.Context) error {
+	close(m.shutdown)
+	return nil
+}
+
+func TestModuleRegistry_InitTimeout(t *testing.T) {
+	m := &slowModule{release: make(chan struct{}), shutdown: make(chan struct{})}
+	mr := NewModuleRegistry()
+	mr.RegisterModule(m)
+	mr.SetInitTimeout(10 * time.Millisecond)
+
+	err := mr.InitializeModules(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("InitializeModules() error = %v, want DeadlineExceeded", err)
+	}
+	if len(mr.running()) != 0 {
+		t.Errorf("running() = %v, want none after a timeout", mr.running())
+	}
+
+	// Init succeeding late shuts the module down instead of leaking it
+	close(m.release)
+	select {
+	case <-m.shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("module was not shut down after its late Init")
+	}
+}
+
+func TestAdmission_NoQueueTimeout(t *testing.T) {
+	a := newAdmission(1, 1, 0, &MetricsCollector{})
+	if err := a.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	// Without a queue timeout a queued request waits for its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := a.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued acquire() error = %v, want the context's error", err)
+	}
+}
+
+func TestEngine_AdmissionControl(t *testing.T) {
+	e := New(&EngineConfig{
+		WorkerPoolSize:   1,
+		QueueSize:        1,
+		QueueTimeout:     20 * time.Millisecond,
+		RetryAfter:       2 * time.Second,
+		AdmissionControl: true,
+	})
+	e.admission = newAdmission(e.config.WorkerPoolSize, e.config.QueueSize, e.config.QueueTimeout, e.metrics)
+
+	release := make(chan struct{})
+	e.GET("/slow", func(c *router.Context) error {
+		<-release
+		return c.String(http.StatusOK, "done")
+	})
+
+	// Occupy the only slot
+	first := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		first <- rec.Code
+	}()
+	for e.Metrics().AdmittedRequests == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Fill the queue; this one times out waiting
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		queued <- rec
+	}()
+	for e.Metrics().QueuedRequests == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Queue is full, so this is rejected immediately
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("saturated response = %d Retry-After %q, want 503 Retry-After 2", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	if got := <-queued; got.Code != http.StatusServiceUnavailable {
+		t.Errorf("queued request status = %d, want 503 after queue timeout", got.Code)
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first request status = %d, want 200", code)
+	}
+
+	m := e.Metrics()
+	if m.RejectedRequests != 1 || m.QueueTimeouts != 1 || m.QueuedRequests != 0 {
+		t.Errorf("metrics = %+v, want 1 rejected, 1 queue timeout, empty queue", m)
+	}
+}
@@ -0,0 +1,420 @@
+package neuron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPoolClosed is returned when submitting to a pool that is shut down
+	ErrPoolClosed = errors.New("worker pool is shut down")
+	// ErrPoolFull is returned by Submit when the job queue is full
+	ErrPoolFull = errors.New("worker pool queue is full")
+)
+
+// WorkerPool manages goroutines for request handling
+type WorkerPool struct {
+	config  WorkerPoolConfig
+	queue   chan *task
+	size    int
+	running sync.WaitGroup
+	closed  bool
+	mu      sync.RWMutex
+
+	// closing is closed when shutdown starts, releasing callers blocked on
+	// a full queue; the queue itself is closed once they have left
+	closing chan struct{}
+	sending sync.WaitGroup
+	stopped chan struct{}
+
+	// abort is closed when a shutdown gives up waiting, cutting short any
+	// retry backoff still in progress
+	abort     chan struct{}
+	abortOnce sync.Once
+
+	active    atomic.Int64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	panicked  atomic.Uint64
+}
+
+// WorkerPoolConfig configures a WorkerPool
+type WorkerPoolConfig struct {
+	Size int
+
+	// QueueSize is the number of jobs that may wait for a worker.
+	// Defaults to 100 per worker.
+	QueueSize int
+
+	// Retry applies to jobs that do not set their own policy
+	Retry RetryPolicy
+
+	// OnError is called for every job that fails after its final attempt
+	OnError func(FailedJob)
+
+	// DeadLetter receives jobs that fail after their final attempt. Sends
+	// never block; failures are logged and dropped while it is full.
+	DeadLetter chan<- FailedJob
+}
+
+// Worker represents a worker in the pool
+type Worker struct {
+	id int
+}
+
+// Job represents a unit of work
+type Job struct {
+	// Name identifies the job in failure reports
+	Name    string
+	Handler func() error
+
+	// Retry overrides the pool's retry policy when MaxAttempts is set
+	Retry RetryPolicy
+}
+
+// RetryPolicy controls how failed jobs are retried. The zero value runs a
+// job once.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry; each later retry waits
+	// Multiplier (default 2) times longer, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+
+	// Retryable reports whether an error is worth retrying. Defaults to
+	// retrying every error.
+	Retryable func(error) bool
+}
+
+// FailedJob describes a job that failed after its final attempt
+type FailedJob struct {
+	Job      Job
+	Err      error
+	Attempts int
+	FailedAt time.Time
+}
+
+// PanicError is the error of a job whose handler panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
+}
+
+// task is a queued job and, for waiting callers, its outcome
+type task struct {
+	job  Job
+	done chan struct{}
+	err  error
+}
+
+// Future is the pending result of a job submitted with SubmitFunc
+type Future[T any] struct {
+	task  *task
+	value T
+}
+
+// Stats returns current worker pool statistics
+type WorkerStats struct {
+	TotalWorkers  int
+	ActiveJobs    int
+	QueuedJobs    int
+	CompletedJobs uint64
+	FailedJobs    uint64
+	RetriedJobs   uint64
+	PanickedJobs  uint64
+}
+
+// NewWorkerPool creates a new worker pool with the specified size
+func NewWorkerPool(size int) *WorkerPool {
+	return NewWorkerPoolWithConfig(WorkerPoolConfig{Size: size})
+}
+
+// NewWorkerPoolWithConfig creates a worker pool from config
+func NewWorkerPoolWithConfig(config WorkerPoolConfig) *WorkerPool {
+	if config.QueueSize <= 0 {
+		config.QueueSize = config.Size * 100
+	}
+
+	pool := &WorkerPool{
+		config:  config,
+		queue:   make(chan *task, config.QueueSize),
+		size:    config.Size,
+		abort:   make(chan struct{}),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	// Initialize workers
+	for i := 0; i < config.Size; i++ {
+		worker := &Worker{
+			id: i,
+		}
+		pool.running.Add(1)
+		go pool.startWorker(worker)
+	}
+
+	return pool
+}
+
+// Submit adds a new job to the worker pool without waiting for it to run
+func (p *WorkerPool) Submit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.queue <- &task{job: job}:
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// SubmitWait adds a job to the pool, waiting for queue space if needed, and
+// returns the job's final error once it has run. If ctx is done first its
+// error is returned; a job that was already queued still runs.
+func (p *WorkerPool) SubmitWait(ctx context.Context, job Job) error {
+	t, err := p.enqueue(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SubmitFunc runs fn on the pool and returns a future for its result,
+// waiting for queue space until ctx is done
+func SubmitFunc[T any](ctx context.Context, p *WorkerPool, fn func() (T, error)) (*Future[T], error) {
+	f := &Future[T]{}
+	t, err := p.enqueue(ctx, Job{Handler: func() error {
+		value, err := fn()
+		f.value = value
+		return err
+	}})
+	if err != nil {
+		return nil, err
+	}
+	f.task = t
+	return f, nil
+}
+
+// Done is closed once the job has finished, including any retries
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.task.done
+}
+
+// Wait returns the job's result once it has finished, or ctx's error if ctx
+// is done first
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.task.done:
+		return f.value, f.task.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// enqueue queues a job whose outcome the caller waits for, blocking until
+// there is room in the queue, the pool shuts down or ctx is done
+func (p *WorkerPool) enqueue(ctx context.Context, job Job) (*task, error) {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil, ErrPoolClosed
+	}
+	// Registered under the lock so that Shutdown waits for this send
+	// before closing the queue
+	p.sending.Add(1)
+	p.mu.RUnlock()
+	defer p.sending.Done()
+
+	t := &task{job: job, done: make(chan struct{})}
+	select {
+	case p.queue <- t:
+		return t, nil
+	case <-p.closing:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startWorker starts a worker's processing loop
+func (p *WorkerPool) startWorker(w *Worker) {
+	defer p.running.Done()
+
+	for t := range p.queue {
+		p.run(t)
+	}
+}
+
+// run executes a job with its retry policy and records the outcome
+func (p *WorkerPool) run(t *task) {
+	p.active.Add(1)
+	defer p.active.Add(-1)
+
+	policy := t.job.Retry
+	if policy.MaxAttempts == 0 {
+		policy = p.config.Retry
+	}
+
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		if err = p.call(t.job); err == nil {
+			break
+		}
+		if attempts >= policy.MaxAttempts || !policy.retryable(err) {
+			break
+		}
+		p.retried.Add(1)
+		if !p.wait(policy.delay(attempts)) {
+			break
+		}
+	}
+
+	if err == nil {
+		p.completed.Add(1)
+	} else {
+		p.failed.Add(1)
+		p.report(FailedJob{Job: t.job, Err: err, Attempts: attempts, FailedAt: time.Now()})
+	}
+
+	if t.done != nil {
+		t.err = err
+		close(t.done)
+	}
+}
+
+// call runs the job's handler, turning a panic into a *PanicError
+func (p *WorkerPool) call(job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.panicked.Add(1)
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return job.Handler()
+}
+
+// wait sleeps for d, returning false if the pool aborts first
+func (p *WorkerPool) wait(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-p.abort:
+		return false
+	}
+}
+
+// report hands a failed job to the error callback and dead-letter channel
+func (p *WorkerPool) report(failed FailedJob) {
+	if p.config.OnError != nil {
+		p.config.OnError(failed)
+	}
+	if p.config.DeadLetter != nil {
+		select {
+		case p.config.DeadLetter <- failed:
+		default:
+			log.Printf("Dead-letter channel full, dropping failed job %q: %v", failed.Job.Name, failed.Err)
+		}
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish, or for ctx to be done
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	// Stop accepting new jobs
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closing)
+		go p.stop()
+	}
+	p.mu.Unlock()
+
+	// Wait for remaining jobs to complete with timeout
+	select {
+	case <-ctx.Done():
+		p.abortOnce.Do(func() { close(p.abort) })
+		return ctx.Err()
+	case <-p.stopped:
+		return nil
+	}
+}
+
+// stop closes the queue once blocked senders have given up, and waits for
+// the workers to drain it
+func (p *WorkerPool) stop() {
+	p.sending.Wait()
+	close(p.queue)
+	p.running.Wait()
+	close(p.stopped)
+}
+
+// Stats returns current statistics about the worker pool
+func (p *WorkerPool) Stats() WorkerStats {
+	return WorkerStats{
+		TotalWorkers:  p.size,
+		ActiveJobs:    int(p.active.Load()),
+		QueuedJobs:    len(p.queue),
+		CompletedJobs: p.completed.Load(),
+		FailedJobs:    p.failed.Load(),
+		RetriedJobs:   p.retried.Load(),
+		PanickedJobs:  p.panicked.Load(),
+	}
+}
+
+func (r RetryPolicy) retryable(err error) bool {
+	return r.Retryable == nil || r.Retryable(err)
+}
+
+// delay returns the backoff before the retry following the given attempt
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(r.Backoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if r.MaxBackoff > 0 && d >= float64(r.MaxBackoff) {
+			return r.MaxBackoff
+		}
+	}
+	if r.MaxBackoff > 0 && d > float64(r.MaxBackoff) {
+		return r.MaxBackoff
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,78 @@
+package neuron
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Environment variables used to hand listeners to a restarted process
+const (
+	envListenFDs = "NEURON_LISTEN_FDS"
+	envReadyFD   = "NEURON_READY_FD"
+)
+
+// listenFD is the first inherited file descriptor (after stdin, stdout, stderr)
+const listenFD = 3
+
+// listen returns the listener for addr, reusing the socket inherited from a
+// parent process during a zero-downtime restart when there is one
+func (e *Engine) listen(addr string) (net.Listener, error) {
+	ln, err := inheritedListener(listenFD)
+	if err != nil || ln != nil {
+		return ln, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// inheritedListener rebuilds the listener passed by a parent process as file
+// descriptor fd, or returns nil when the process was not started by a restart
+func inheritedListener(fd uintptr) (net.Listener, error) {
+	value := os.Getenv(envListenFDs)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envListenFDs)
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid %s value %q", envListenFDs, value)
+	}
+
+	f := os.NewFile(fd, "listener")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	return ln, nil
+}
+
+// notifyReady tells the parent process that this process is serving so it
+// can start draining. It is a no-op when there is no parent waiting.
+func notifyReady() error {
+	value := os.Getenv(envReadyFD)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(envReadyFD)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q", envReadyFD, value)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Restarted is closed once the engine has handed its listener to a new
+// process and finished draining; the current process should then exit
+func (e *Engine) Restarted() <-chan struct{} {
+	return e.restarted
+}
@@ -0,0 +1,136 @@
+//go:build !windows
+
+package neuron
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// watchRestartSignals restarts the engine on SIGHUP or SIGUSR2
+func (e *Engine) watchRestartSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case sig := <-sigs:
+				log.Printf("Received %v, restarting", sig)
+				if err := e.Restart(); err != nil {
+					log.Printf("Restart failed: %v", err)
+					continue
+				}
+				return
+			case <-e.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// Restart starts a new copy of the running binary with the listening socket
+// as an inherited file descriptor, waits until the new process reports that
+// it is serving, then drains and shuts down this engine. If the new process
+// fails to become ready, it is killed and this engine keeps serving and can
+// be restarted again. Only one restart runs at a time.
+func (e *Engine) Restart() error {
+	if e.listener == nil {
+		return errors.New("engine is not listening")
+	}
+	if !e.restarting.CompareAndSwap(false, true) {
+		return errors.New("restart already in progress")
+	}
+	handedOver := false
+	defer func() {
+		if !handedOver {
+			e.restarting.Store(false)
+		}
+	}()
+
+	filer, ok := e.listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("listener %T cannot be handed over", e.listener)
+	}
+	lnFile, err := filer.File()
+	if err != nil {
+		return fmt.Errorf("failed to get listener file: %w", err)
+	}
+	defer lnFile.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles[i] becomes file descriptor 3+i in the child
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	cmd.Env = append(os.Environ(),
+		envListenFDs+"=1",
+		envReadyFD+"="+strconv.Itoa(listenFD+1),
+	)
+
+	if err := cmd.Start(); err != nil {
+		readyW.Close()
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	// Only the child holds the write end now, so a child that exits before
+	// becoming ready unblocks the read below with EOF
+	readyW.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		ready <- err
+	}()
+
+	timeout := e.config.RestartTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("new process exited before becoming ready: %w", err)
+		}
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process not ready after %v", timeout)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+	handedOver = true
+
+	log.Printf("New process %d is ready, draining", pid)
+
+	ctx, cancel := e.shutdownContext()
+	defer cancel()
+
+	err = e.Shutdown(ctx)
+	close(e.restarted)
+	return err
+}
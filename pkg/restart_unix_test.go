@@ -0,0 +1,150 @@
+//go:build !windows
+
+package neuron
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// dupFD returns a copy of f's descriptor that no *os.File owns, as a
+// restarted process receives it
+func dupFD(t *testing.T, f *os.File) int {
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Dup() error = %v", err)
+	}
+	return fd
+}
+
+func TestInheritedListener(t *testing.T) {
+	t.Setenv(envListenFDs, "")
+	if ln, err := inheritedListener(listenFD); ln != nil || err != nil {
+		t.Fatalf("inheritedListener() without %s = %v, %v, want nil", envListenFDs, ln, err)
+	}
+
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	fd := dupFD(t, f)
+	f.Close()
+
+	t.Setenv(envListenFDs, "1")
+	ln, err := inheritedListener(uintptr(fd))
+	if err != nil {
+		t.Fatalf("inheritedListener() error = %v", err)
+	}
+	defer ln.Close()
+	if os.Getenv(envListenFDs) != "" {
+		t.Errorf("%s still set after inheriting", envListenFDs)
+	}
+	if ln.Addr().String() != parent.Addr().String() {
+		t.Errorf("inherited address = %s, want %s", ln.Addr(), parent.Addr())
+	}
+
+	// Close the parent's copy so only the inherited listener can accept
+	parent.Close()
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			_, err = conn.Write([]byte("ok"))
+			conn.Close()
+		}
+		accepted <- err
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ok" {
+		t.Errorf("Read() = %q, %v, want ok", buf, err)
+	}
+	if err := <-accepted; err != nil {
+		t.Errorf("Accept() error = %v", err)
+	}
+
+	t.Setenv(envListenFDs, "zero")
+	if _, err := inheritedListener(listenFD); err == nil {
+		t.Error("inheritedListener() with invalid value succeeded, want error")
+	}
+}
+
+func TestNotifyReady(t *testing.T) {
+	t.Setenv(envReadyFD, "")
+	if err := notifyReady(); err != nil {
+		t.Fatalf("notifyReady() without parent error = %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer r.Close()
+	fd := dupFD(t, w)
+	w.Close()
+
+	t.Setenv(envReadyFD, strconv.Itoa(fd))
+	if err := notifyReady(); err != nil {
+		t.Fatalf("notifyReady() error = %v", err)
+	}
+	if os.Getenv(envReadyFD) != "" {
+		t.Errorf("%s still set after notifying", envReadyFD)
+	}
+
+	// notifyReady closed the last write end, so the byte is followed by EOF
+	buf := make([]byte, 2)
+	n, err := r.Read(buf)
+	if err != nil || n != 1 || buf[0] != 1 {
+		t.Fatalf("Read() = %v, %v, want the ready byte", buf[:n], err)
+	}
+	if _, err := r.Read(buf); err == nil {
+		t.Error("Read() after ready byte succeeded, want EOF")
+	}
+}
+
+func TestEngine_RestartRequiresListener(t *testing.T) {
+	e := New(&EngineConfig{})
+	if err := e.Restart(); err == nil {
+		t.Error("Restart() before Start succeeded, want error")
+	}
+}
+
+// plainListener hides the *net.TCPListener's File method
+type plainListener struct{ net.Listener }
+
+func TestEngine_RestartInProgress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	e := New(&EngineConfig{})
+	e.listener = plainListener{ln}
+
+	// A failed restart can be retried
+	for i := 0; i < 2; i++ {
+		if err := e.Restart(); err == nil || strings.Contains(err.Error(), "in progress") {
+			t.Fatalf("Restart() error = %v, want the listener handover error", err)
+		}
+	}
+
+	e.restarting.Store(true)
+	if err := e.Restart(); err == nil || !strings.Contains(err.Error(), "in progress") {
+		t.Errorf("concurrent Restart() error = %v, want restart already in progress", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package neuron
+
+import "errors"
+
+// watchRestartSignals is a no-op; Windows has no SIGHUP or SIGUSR2
+func (e *Engine) watchRestartSignals() {}
+
+// Restart is not supported on Windows, which cannot pass listening sockets
+// to a child process as inherited file descriptors
+func (e *Engine) Restart() error {
+	return errors.New("zero-downtime restart is not supported on windows")
+}
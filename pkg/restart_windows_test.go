@@ -0,0 +1,12 @@
+//go:build windows
+
+package neuron
+
+import "testing"
+
+func TestEngine_RestartUnsupported(t *testing.T) {
+	e := New(&EngineConfig{})
+	if err := e.Restart(); err == nil {
+		t.Error("Restart() on windows succeeded, want error")
+	}
+}
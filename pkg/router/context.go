@@ -53,3 +53,17 @@ func (c *Context) String(code int, s string) error {
 	_, err := c.Response.Write([]byte(s))
 	return err
 }
+
+// Set stores a value on the context for the lifetime of the request
+func (c *Context) Set(key string, value interface{}) {
+	if c.store == nil {
+		c.store = make(map[string]interface{}, 8)
+	}
+	c.store[key] = value
+}
+
+// Get returns a value stored with Set
+func (c *Context) Get(key string) (interface{}, bool) {
+	value, ok := c.store[key]
+	return value, ok
+}
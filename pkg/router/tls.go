@@ -0,0 +1,57 @@
+package router
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+// PeerIdentity describes a client authenticated with a verified TLS
+// certificate (mutual TLS)
+type PeerIdentity struct {
+	CommonName     string
+	Organization   []string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	SerialNumber   string
+	Issuer         string
+	Fingerprint    string // hex encoded SHA-256 of the DER certificate
+	NotAfter       time.Time
+	Certificate    *x509.Certificate
+}
+
+// PeerIdentity returns the identity of the client certificate verified
+// during the TLS handshake. It returns false for plain HTTP requests and for
+// TLS connections without a verified client certificate.
+func (c *Context) PeerIdentity() (*PeerIdentity, bool) {
+	if c.Request == nil || c.Request.TLS == nil {
+		return nil, false
+	}
+	chains := c.Request.TLS.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, false
+	}
+
+	cert := chains[0][0]
+	sum := sha256.Sum256(cert.Raw)
+
+	uris := make([]string, 0, len(cert.URIs))
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+
+	return &PeerIdentity{
+		CommonName:     cert.Subject.CommonName,
+		Organization:   cert.Subject.Organization,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           uris,
+		SerialNumber:   cert.SerialNumber.String(),
+		Issuer:         cert.Issuer.CommonName,
+		Fingerprint:    hex.EncodeToString(sum[:]),
+		NotAfter:       cert.NotAfter,
+		Certificate:    cert,
+	}, true
+}
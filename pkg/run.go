@@ -0,0 +1,96 @@
+package neuron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Runner is implemented by modules with a long-running loop. Run is started
+// after the server is listening and its context is cancelled during
+// shutdown; returning an error other than the context's stops the engine.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Run starts the engine and blocks until ctx is cancelled, SIGINT or SIGTERM
+// arrives, or a listener or module fails. It then shuts down gracefully,
+// bounded by DrainPeriod plus ShutdownTimeout (30s when unset), and returns
+// the first fatal error, joined with any shutdown error.
+func (e *Engine) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := e.Start(); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	case runErr = <-e.errs:
+		log.Printf("Shutting down after error: %v", runErr)
+	case <-e.restarted:
+		// A new process took over and this one has already drained
+		return nil
+	}
+
+	shutdownCtx, cancel := e.shutdownContext()
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
+
+// Errors returns a channel receiving the first fatal error from a listener
+// or module, for callers that use Start instead of Run
+func (e *Engine) Errors() <-chan error {
+	return e.errs
+}
+
+// fail records a fatal error; only the first one is kept
+func (e *Engine) fail(err error) {
+	select {
+	case e.errs <- err:
+	default:
+		log.Printf("Additional fatal error: %v", err)
+	}
+}
+
+// startRunners starts the event transport and the Run loop of every module
+// implementing Runner
+func (e *Engine) startRunners() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancelRun = cancel
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		if err := e.events.Run(ctx); err != nil && ctx.Err() == nil {
+			e.fail(fmt.Errorf("event transport failed: %w", err))
+		}
+	}()
+
+	for _, module := range e.modules.running() {
+		runner, ok := module.(Runner)
+		if !ok {
+			continue
+		}
+
+		name := module.Name()
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			if err := runner.Run(ctx); err != nil && ctx.Err() == nil {
+				e.fail(fmt.Errorf("module %s failed: %w", name, err))
+			}
+		}()
+	}
+}
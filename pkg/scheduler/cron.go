@@ -0,0 +1,241 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	second, minute, hour, dom, month, dow bits
+	// domStar and dowStar record unrestricted day fields: when both day
+	// fields are restricted a day matching either one matches
+	domStar, dowStar bool
+
+	every    time.Duration
+	location *time.Location
+}
+
+type bits uint64
+
+func (b bits) has(n int) bool { return b&(1<<uint(n)) != 0 }
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = field{min: 0, max: 59}
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse parses a cron expression in loc. It accepts six fields (second
+// minute hour day-of-month month day-of-week), five fields with seconds
+// fixed at zero, descriptors such as @daily, and @every <duration>.
+func Parse(spec string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid cron expression %q: bad interval", spec)
+		}
+		return &Schedule{every: d, location: loc}, nil
+	}
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 or 6 fields, got %d", spec, len(fields))
+	}
+
+	s := &Schedule{location: loc}
+	var err error
+	parsers := []struct {
+		dst  *bits
+		spec string
+		f    field
+	}{
+		{&s.second, fields[0], secondField},
+		{&s.minute, fields[1], minuteField},
+		{&s.hour, fields[2], hourField},
+		{&s.dom, fields[3], domField},
+		{&s.month, fields[4], monthField},
+		{&s.dow, fields[5], dowField},
+	}
+	for _, p := range parsers {
+		if *p.dst, err = parseField(p.spec, p.f); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domStar = isStar(fields[3])
+	s.dowStar = isStar(fields[5])
+	return s, nil
+}
+
+func isStar(spec string) bool {
+	return spec == "*" || spec == "?"
+}
+
+// parseField parses a comma-separated list of values, ranges and steps
+func parseField(spec string, f field) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case isStar(part):
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/15" runs from 5 to the end of the range
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation time after t, or the zero time if
+// there is none within five years
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	loc := s.location
+	t = t.In(loc)
+	// Start at the next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for !s.month.has(int(t.Month())) {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for !s.hour.has(t.Hour()) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for !s.minute.has(t.Minute()) {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for !s.second.has(t.Second()) {
+		t = t.Truncate(time.Second).Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"neuron/pkg/lock"
+)
+
+// LockWith adapts a lock.Locker for the scheduler. Locks taken for jobs are
+// never released early; they expire shortly before the job's next
+// occurrence is due.
+func LockWith(locker lock.Locker) Locker {
+	return lockAdapter{locker: locker}
+}
+
+type lockAdapter struct {
+	locker lock.Locker
+}
+
+func (a lockAdapter) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	_, err := a.locker.TryLock(ctx, key, ttl)
+	if errors.Is(err, lock.ErrNotAcquired) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,397 @@
+// Package scheduler runs functions on cron schedules as a neuron module.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Overlap decides what happens when a job is due while its previous run is
+// still going
+type Overlap int
+
+const (
+	// OverlapSkip drops the run (the default)
+	OverlapSkip Overlap = iota
+	// OverlapAllow starts the run alongside the previous one
+	OverlapAllow
+	// OverlapQueue runs once more as soon as the previous run finishes;
+	// further runs due in the meantime are merged into that one
+	OverlapQueue
+)
+
+// Locker takes distributed locks so that only one replica runs a given
+// occurrence of a job. TryLock returns false when another holder has key.
+// Use LockWith to adapt a lock.Locker.
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// Config configures a Scheduler
+type Config struct {
+	// TimeZone is the IANA zone schedules are evaluated in, usually
+	// config.AppConfig.TimeZone. Defaults to the local zone.
+	TimeZone string
+
+	// Locker, if set, is used by jobs with Lock enabled
+	Locker Locker
+
+	// LockPrefix is prepended to job names to form lock keys. Defaults to
+	// "scheduler:".
+	LockPrefix string
+}
+
+// JobOptions control how a job runs
+type JobOptions struct {
+	// Jitter delays each run by a random duration up to Jitter, to spread
+	// load when many replicas or jobs share a schedule
+	Jitter time.Duration
+
+	Overlap Overlap
+
+	// Timeout bounds each run; zero means no timeout
+	Timeout time.Duration
+
+	// TimeZone overrides the scheduler's time zone for this job
+	TimeZone string
+
+	// Lock runs each occurrence on one replica only. The lock is held until
+	// the next occurrence is due, so replicas whose clocks differ slightly
+	// do not run the same occurrence twice.
+	Lock bool
+}
+
+// JobStats is a snapshot of a job's history
+type JobStats struct {
+	Name         string
+	Spec         string
+	Running      int
+	Runs         uint64
+	Failures     uint64
+	Skipped      uint64
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	NextRun      time.Time
+}
+
+// Scheduler runs jobs on cron schedules. It implements neuron.Module and
+// neuron.Runner: jobs are started when the engine runs and awaited when it
+// shuts down.
+type Scheduler struct {
+	config   Config
+	location *time.Location
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context
+	running sync.WaitGroup
+	// stopped is set by Shutdown; no goroutine joins running after it
+	stopped bool
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule *Schedule
+	fn       func(ctx context.Context) error
+	opts     JobOptions
+
+	// guarded by Scheduler.mu
+	stats   JobStats
+	pending bool
+}
+
+// New creates a scheduler
+func New(config Config) (*Scheduler, error) {
+	location, err := loadLocation(config.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	if config.LockPrefix == "" {
+		config.LockPrefix = "scheduler:"
+	}
+
+	return &Scheduler{
+		config:   config,
+		location: location,
+		jobs:     make(map[string]*job),
+	}, nil
+}
+
+// Add schedules fn under name. Jobs added while the scheduler runs start
+// immediately.
+func (s *Scheduler) Add(name, spec string, fn func(ctx context.Context) error, opts JobOptions) error {
+	location := s.location
+	if opts.TimeZone != "" {
+		var err error
+		if location, err = loadLocation(opts.TimeZone); err != nil {
+			return err
+		}
+	}
+	if opts.Lock && s.config.Locker == nil {
+		return fmt.Errorf("job %s requires a lock but the scheduler has no Locker", name)
+	}
+
+	schedule, err := Parse(spec, location)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %s is already scheduled", name)
+	}
+	j := &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+		opts:     opts,
+		stats:    JobStats{Name: name, Spec: spec},
+	}
+	s.jobs[name] = j
+
+	if s.ctx != nil {
+		s.start(s.ctx, j)
+	}
+	return nil
+}
+
+// Name implements neuron.Module
+func (s *Scheduler) Name() string {
+	return "scheduler"
+}
+
+// Init implements neuron.Module
+func (s *Scheduler) Init(ctx context.Context) error {
+	return nil
+}
+
+// Run starts every job and blocks until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.ctx != nil {
+		s.mu.Unlock()
+		return errors.New("scheduler is already running")
+	}
+	s.ctx = ctx
+	for _, j := range s.jobs {
+		s.start(ctx, j)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Shutdown implements neuron.Module, waiting for running jobs to finish
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of every job, ordered by name
+func (s *Scheduler) Stats() []JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]JobStats, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		stats = append(stats, j.stats)
+	}
+	sort.Slice(stats, func(i, k int) bool { return stats[i].Name < stats[k].Name })
+	return stats
+}
+
+// start launches the job's timer loop unless the scheduler has shut down.
+// Callers hold s.mu.
+func (s *Scheduler) start(ctx context.Context, j *job) {
+	if s.stopped {
+		return
+	}
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.loop(ctx, j)
+	}()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	for {
+		now := time.Now()
+		next := j.schedule.Next(now)
+		if next.IsZero() {
+			log.Printf("Scheduled job %s has no future runs", j.name)
+			return
+		}
+
+		s.mu.Lock()
+		j.stats.NextRun = next
+		s.mu.Unlock()
+
+		delay := next.Sub(now)
+		if j.opts.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(j.opts.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.fire(ctx, j, next)
+	}
+}
+
+// fire applies the overlap policy and lock, then runs the job
+func (s *Scheduler) fire(ctx context.Context, j *job, scheduled time.Time) {
+	s.mu.Lock()
+	if j.stats.Running > 0 {
+		switch j.opts.Overlap {
+		case OverlapSkip:
+			j.stats.Skipped++
+			s.mu.Unlock()
+			return
+		case OverlapQueue:
+			if j.pending {
+				j.stats.Skipped++
+			}
+			j.pending = true
+			s.mu.Unlock()
+			return
+		}
+	}
+	j.stats.Running++
+	s.mu.Unlock()
+
+	if j.opts.Lock && !s.lock(ctx, j, scheduled) {
+		s.mu.Lock()
+		j.stats.Running--
+		j.stats.Skipped++
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		j.stats.Running--
+		s.mu.Unlock()
+		return
+	}
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.running.Done()
+		for {
+			s.execute(ctx, j)
+
+			s.mu.Lock()
+			if !j.pending || ctx.Err() != nil {
+				j.stats.Running--
+				s.mu.Unlock()
+				return
+			}
+			j.pending = false
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// lock takes the job's distributed lock for the occurrence due at
+// scheduled. The lock expires a tenth of the interval before the next
+// occurrence, measured from when it is taken, so late fires and clock
+// differences between replicas cannot make it outlive its occurrence and
+// skip the next one.
+func (s *Scheduler) lock(ctx context.Context, j *job, scheduled time.Time) bool {
+	next := j.schedule.Next(scheduled)
+	ttl := time.Second
+	if !next.IsZero() {
+		ttl = time.Until(next) - next.Sub(scheduled)/10
+	}
+	if ttl <= 0 {
+		log.Printf("Scheduled job %s fired too late to lock its occurrence", j.name)
+		return false
+	}
+
+	ok, err := s.config.Locker.TryLock(ctx, s.config.LockPrefix+j.name, ttl)
+	if err != nil {
+		log.Printf("Failed to lock scheduled job %s: %v", j.name, err)
+		return false
+	}
+	return ok
+}
+
+// execute runs the job once and records the outcome
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	runCtx := ctx
+	if j.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, j.opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := call(runCtx, j.fn)
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j.stats.Runs++
+	j.stats.LastRun = start
+	j.stats.LastDuration = elapsed
+	j.stats.LastError = ""
+	if err != nil {
+		j.stats.Failures++
+		j.stats.LastError = err.Error()
+		log.Printf("Scheduled job %s failed: %v", j.name, err)
+	}
+}
+
+// call runs fn, turning a panic into an error
+func call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone %q: %w", name, err)
+	}
+	return location, nil
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	from := time.Date(2024, 1, 31, 10, 15, 30, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		spec string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"*/10 * * * * *", time.UTC, time.Date(2024, 1, 31, 10, 15, 40, 0, time.UTC)},
+		{"0 30 9 * * *", time.UTC, time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.UTC, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 0 29 2 *", time.UTC, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 0 15 * SUN", time.UTC, time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.UTC, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.UTC, from.Add(90 * time.Second)},
+		// 12:00 in Lagos (UTC+1) is 11:00 UTC
+		{"0 0 12 * * *", lagos, time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec, tt.loc)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"* * *", "60 * * * * *", "0 0 0 * 13 *", "@every -1s", "*/0 * * * *"} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+// ttlLocker is an in-memory Locker whose locks expire after their TTL
+type ttlLocker struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newTTLLocker() *ttlLocker {
+	return &ttlLocker{expires: make(map[string]time.Time)}
+}
+
+func (l *ttlLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Before(l.expires[key]) {
+		return false, nil
+	}
+	l.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+func TestScheduler(t *testing.T) {
+	s, err := New(Config{TimeZone: "UTC"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var slowRuns int32
+	release := make(chan struct{})
+	s.Add("slow", "@every 10ms", func(ctx context.Context) error {
+		atomic.AddInt32(&slowRuns, 1)
+		<-release
+		return nil
+	}, JobOptions{Overlap: OverlapSkip})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	cancel()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if n := atomic.LoadInt32(&slowRuns); n != 1 {
+		t.Errorf("slow job ran %d times, want 1 while its first run blocks", n)
+	}
+
+	for _, st := range s.Stats() {
+		if st.Name == "slow" && (st.Skipped == 0 || st.Runs != 1) {
+			t.Errorf("slow stats = %+v, want 1 run and skipped runs", st)
+		}
+	}
+}
+
+func TestScheduler_LockAcrossReplicas(t *testing.T) {
+	locker := newTTLLocker()
+
+	var mu sync.Mutex
+	runs := map[int64]int{}
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	var replicas []*Scheduler
+	for i := 0; i < 3; i++ {
+		s, err := New(Config{TimeZone: "UTC", Locker: locker})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		s.Add("report", "* * * * * *", func(ctx context.Context) error {
+			mu.Lock()
+			runs[time.Now().Unix()]++
+			mu.Unlock()
+			return nil
+		}, JobOptions{Lock: true, Jitter: 100 * time.Millisecond})
+		go s.Run(ctx)
+		replicas = append(replicas, s)
+	}
+
+	time.Sleep(3300 * time.Millisecond)
+	end := time.Now()
+	cancel()
+	for _, s := range replicas {
+		s.Shutdown(context.Background())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Every occurrence that fired, jitter included, within the window
+	for second := start.Unix() + 1; time.Unix(second, 0).Add(150 * time.Millisecond).Before(end); second++ {
+		if runs[second] == 0 {
+			t.Errorf("occurrence at %d was skipped by every replica", second)
+		}
+	}
+	for second, n := range runs {
+		if n != 1 {
+			t.Errorf("occurrence at %d ran %d times, want once across replicas", second, n)
+		}
+	}
+}
+
+func TestScheduler_AddAfterShutdown(t *testing.T) {
+	s, err := New(Config{TimeZone: "UTC"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	var runs int32
+	s.Add("late", "@every 1ms", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, JobOptions{})
+	time.Sleep(20 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Errorf("job added after Shutdown ran %d times, want 0", n)
+	}
+	if st := s.Stats(); len(st) != 1 || !st[0].NextRun.IsZero() {
+		t.Errorf("Stats() = %+v, want the late job unscheduled", st)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"neuron/pkg/config"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// NewHTTP2Server builds the HTTP/2 server settings from configuration,
+// falling back to the framework defaults for zero values
+func NewHTTP2Server(cfg config.HTTP2Config) *http2.Server {
+	h2s := &http2.Server{
+		MaxConcurrentStreams:         250,
+		MaxReadFrameSize:             1048576,
+		IdleTimeout:                  10 * time.Second,
+		MaxUploadBufferPerConnection: cfg.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     cfg.MaxUploadBufferPerStream,
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		h2s.MaxConcurrentStreams = cfg.MaxConcurrentStreams
+	}
+	if cfg.MaxReadFrameSize > 0 {
+		h2s.MaxReadFrameSize = cfg.MaxReadFrameSize
+	}
+	if cfg.IdleTimeout > 0 {
+		h2s.IdleTimeout = time.Duration(cfg.IdleTimeout) * time.Second
+	}
+	return h2s
+}
+
+// ConfigureHTTP2 enables HTTP/2 on srv. Over TLS it is negotiated with ALPN;
+// with cfg.H2C set, the handler is also wrapped to accept cleartext HTTP/2
+// with prior knowledge or via an Upgrade: h2c request. Callers serving TLS
+// should leave H2C off.
+func ConfigureHTTP2(srv *http.Server, cfg config.HTTP2Config) error {
+	h2s := NewHTTP2Server(cfg)
+
+	if cfg.H2C {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+
+	return http2.ConfigureServer(srv, h2s)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"neuron/pkg/config"
+
+	"golang.org/x/net/http2"
+)
+
+func TestConfigureHTTP2_H2C(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if err := ConfigureHTTP2(srv.Config, config.HTTP2Config{H2C: true, MaxConcurrentStreams: 10}); err != nil {
+		t.Fatalf("ConfigureHTTP2() error = %v", err)
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// Prior knowledge: speak HTTP/2 over a plain TCP connection
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("response protocol = %s, want HTTP/2.0", resp.Proto)
+	}
+}
@@ -3,14 +3,14 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
 	"runtime"
 	"time"
 
+	"neuron/pkg/config"
 	"neuron/pkg/logger"
-
-	"golang.org/x/net/http2"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status and size
@@ -34,26 +34,27 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
-func NewServer(handler http.Handler, logger *logger.Logger) (*http.Server, net.Listener) {
+// NewServer creates an optimized HTTP server and its listener. Zero values in
+// cfg fall back to the defaults below; when cfg.TLS is enabled the returned
+// listener terminates TLS.
+func NewServer(handler http.Handler, logger *logger.Logger, cfg config.ServerConfig) (*http.Server, net.Listener) {
 	// Set GOMAXPROCS to match CPU cores
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	addr := ":8080"
+	if cfg.Port > 0 {
+		addr = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	}
+
 	// Configure TCP keep-alive listener
 	lc := net.ListenConfig{
 		KeepAlive: 30 * time.Second,
 	}
-	ln, err := lc.Listen(context.Background(), "tcp", ":8080")
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
 	if err != nil {
 		panic(err)
 	}
 
-	// HTTP/2 config
-	h2Config := &http2.Server{
-		MaxConcurrentStreams: 250,
-		MaxReadFrameSize:     1048576,
-		IdleTimeout:          10 * time.Second,
-	}
-
 	// TLS config for HTTP/2
 	tlsConfig := &tls.Config{
 		PreferServerCipherSuites: true,
@@ -63,6 +64,13 @@ func NewServer(handler http.Handler, logger *logger.Logger) (*http.Server, net.L
 		},
 		MinVersion: tls.VersionTLS12,
 	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err = NewTLSConfig(cfg.TLS, logger)
+		if err != nil {
+			ln.Close()
+			panic(err)
+		}
+	}
 
 	// Wrap handler with logging middleware
 	loggingHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +99,7 @@ func NewServer(handler http.Handler, logger *logger.Logger) (*http.Server, net.L
 
 	// Create optimized server
 	server := &http.Server{
-		Addr:              ":8080",
+		Addr:              addr,
 		Handler:           loggingHandler,
 		ReadTimeout:       5 * time.Second,
 		WriteTimeout:      10 * time.Second,
@@ -101,8 +109,30 @@ func NewServer(handler http.Handler, logger *logger.Logger) (*http.Server, net.L
 		TLSConfig:         tlsConfig,
 	}
 
-	// Enable HTTP/2
-	http2.ConfigureServer(server, h2Config)
+	if cfg.ReadTimeout > 0 {
+		server.ReadTimeout = time.Duration(cfg.ReadTimeout) * time.Second
+	}
+	if cfg.WriteTimeout > 0 {
+		server.WriteTimeout = time.Duration(cfg.WriteTimeout) * time.Second
+	}
+	if cfg.MaxHeaderBytes > 0 {
+		server.MaxHeaderBytes = cfg.MaxHeaderBytes
+	}
+
+	// Enable HTTP/2, in cleartext too when h2c is configured
+	h2Config := cfg.HTTP2
+	if cfg.TLS.Enabled {
+		h2Config.H2C = false
+	}
+	if err := ConfigureHTTP2(server, h2Config); err != nil {
+		ln.Close()
+		panic(err)
+	}
+
+	// Terminate TLS on the listener so callers can keep using Serve(ln)
+	if cfg.TLS.Enabled {
+		ln = tls.NewListener(ln, server.TLSConfig)
+	}
 
 	return server, ln
 }
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"neuron/pkg/config"
+	"neuron/pkg/logger"
+)
+
+// DefaultReloadInterval is how often certificate files are checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+// certEntry is a certificate/key pair that is reloaded when its files change
+type certEntry struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+// CertStore serves certificates by SNI server name and reloads them from disk
+// without a restart when the underlying files change
+type CertStore struct {
+	def      *certEntry
+	byName   map[string]*certEntry
+	interval time.Duration
+	logger   *logger.Logger
+}
+
+// NewCertStore loads the default and SNI certificates described by cfg
+func NewCertStore(cfg config.TLSConfig, log *logger.Logger) (*CertStore, error) {
+	s := &CertStore{
+		byName:   make(map[string]*certEntry),
+		interval: DefaultReloadInterval,
+		logger:   log,
+	}
+	switch {
+	case cfg.ReloadInterval > 0:
+		s.interval = time.Duration(cfg.ReloadInterval) * time.Second
+	case cfg.ReloadInterval < 0:
+		s.interval = 0
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		entry, err := s.add(cfg.CertFile, cfg.KeyFile, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.def = entry
+	}
+
+	for _, c := range cfg.Certificates {
+		entry, err := s.add(c.CertFile, c.KeyFile, c.ServerNames)
+		if err != nil {
+			return nil, err
+		}
+		if s.def == nil {
+			s.def = entry
+		}
+	}
+
+	if s.def == nil {
+		return nil, errors.New("tls: no certificate configured")
+	}
+
+	return s, nil
+}
+
+// add loads a certificate and indexes it by the configured server names, or
+// by the names in the certificate itself when none are configured
+func (s *CertStore) add(certFile, keyFile string, names []string) (*certEntry, error) {
+	entry := &certEntry{certFile: certFile, keyFile: keyFile}
+	if err := entry.load(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 && entry.cert.Leaf != nil {
+		names = entry.cert.Leaf.DNSNames
+	}
+	for _, name := range names {
+		s.byName[strings.ToLower(name)] = entry
+	}
+
+	return entry, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	entry := s.lookup(hello.ServerName)
+	if s.interval > 0 {
+		entry.maybeReload(s.interval, s.logger)
+	}
+
+	entry.mu.RLock()
+	defer entry.mu.RUnlock()
+	return entry.cert, nil
+}
+
+// lookup finds the certificate for a server name, trying an exact match, then
+// a wildcard match on the parent domain, then the default certificate
+func (s *CertStore) lookup(serverName string) *certEntry {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return s.def
+	}
+	if entry, ok := s.byName[name]; ok {
+		return entry
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if entry, ok := s.byName["*"+name[i:]]; ok {
+			return entry
+		}
+	}
+	return s.def
+}
+
+// Reload forces every certificate to be read from disk again
+func (s *CertStore) Reload() error {
+	seen := map[*certEntry]bool{s.def: true}
+	if err := s.def.load(); err != nil {
+		return err
+	}
+	for _, entry := range s.byName {
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		if err := entry.load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maybeReload reloads the entry if its files changed since the last check.
+// A failed reload keeps serving the previous certificate.
+func (e *certEntry) maybeReload(interval time.Duration, log *logger.Logger) {
+	e.mu.RLock()
+	due := time.Since(e.checked) >= interval
+	e.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	e.mu.Lock()
+	if time.Since(e.checked) < interval {
+		e.mu.Unlock()
+		return
+	}
+	e.checked = time.Now()
+	certMod, keyMod := e.certMod, e.keyMod
+	e.mu.Unlock()
+
+	newCertMod, err1 := modTime(e.certFile)
+	newKeyMod, err2 := modTime(e.keyFile)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	if newCertMod.Equal(certMod) && newKeyMod.Equal(keyMod) {
+		return
+	}
+
+	if err := e.load(); err != nil && log != nil {
+		log.Error("TLS certificate reload failed for %s: %v", e.certFile, err)
+	}
+}
+
+// load reads the certificate and key pair from disk
+func (e *certEntry) load() error {
+	certMod, err := modTime(e.certFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	keyMod, err := modTime(e.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(e.certFile, e.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: loading %s: %w", e.certFile, err)
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	e.mu.Lock()
+	e.cert = &cert
+	e.certMod = certMod
+	e.keyMod = keyMod
+	e.checked = time.Now()
+	e.mu.Unlock()
+	return nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// NewTLSConfig builds a server TLS configuration with hot-reloaded, SNI
+// selected certificates and optional client certificate verification
+func NewTLSConfig(cfg config.TLSConfig, log *logger.Logger) (*tls.Config, error) {
+	store, err := NewCertStore(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion, err := parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: store.GetCertificate,
+		CurvePreferences: []tls.CurveID{
+			tls.CurveP256,
+			tls.X25519,
+		},
+		MinVersion: minVersion,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: reading client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if cfg.ClientAuth != "" {
+		clientAuth, err := parseClientAuth(cfg.ClientAuth)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = clientAuth
+	}
+
+	return tlsConfig, nil
+}
+
+func parseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require-and-verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("tls: unknown client auth mode %q", s)
+	}
+}
+
+func parseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tls: unsupported minimum version %q", s)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"neuron/pkg/config"
+)
+
+func writeCert(t *testing.T, dir, name, cn string, dnsNames ...string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertStore_SNI(t *testing.T) {
+	dir := t.TempDir()
+	defCert, defKey := writeCert(t, dir, "default", "default")
+	apiCert, apiKey := writeCert(t, dir, "api", "api", "api.example.com")
+	wildCert, wildKey := writeCert(t, dir, "wild", "wild")
+
+	store, err := NewCertStore(config.TLSConfig{
+		CertFile: defCert,
+		KeyFile:  defKey,
+		Certificates: []config.TLSCertificate{
+			{CertFile: apiCert, KeyFile: apiKey},
+			{CertFile: wildCert, KeyFile: wildKey, ServerNames: []string{"*.partner.example.com"}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewCertStore() error = %v", err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "", want: "default"},
+		{serverName: "api.example.com", want: "api"},
+		{serverName: "API.example.com.", want: "api"},
+		{serverName: "bank.partner.example.com", want: "wild"},
+		{serverName: "unknown.example.com", want: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if err != nil {
+				t.Fatalf("GetCertificate() error = %v", err)
+			}
+			if got := cert.Leaf.Subject.CommonName; got != tt.want {
+				t.Errorf("GetCertificate(%q) = %s, want %s", tt.serverName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server", "old")
+
+	store, err := NewCertStore(config.TLSConfig{CertFile: certFile, KeyFile: keyFile}, nil)
+	if err != nil {
+		t.Fatalf("NewCertStore() error = %v", err)
+	}
+	store.interval = time.Nanosecond
+
+	writeCert(t, dir, "server", "new")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	if got := cert.Leaf.Subject.CommonName; got != "new" {
+		t.Errorf("certificate after reload = %s, want new", got)
+	}
+}
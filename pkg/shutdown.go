@@ -0,0 +1,157 @@
+package neuron
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultShutdownTimeout bounds the wait for in-flight work during a
+// shutdown the engine starts itself when ShutdownTimeout is not set
+const defaultShutdownTimeout = 30 * time.Second
+
+// ShutdownError reports what was still running when a graceful shutdown ran
+// out of time or failed
+type ShutdownError struct {
+	InFlightRequests int64
+	ActiveJobs       int
+	QueuedJobs       int
+	Errs             []error
+}
+
+func (e *ShutdownError) Error() string {
+	var parts []string
+	if e.InFlightRequests > 0 {
+		parts = append(parts, fmt.Sprintf("%d requests in flight", e.InFlightRequests))
+	}
+	if e.ActiveJobs > 0 || e.QueuedJobs > 0 {
+		parts = append(parts, fmt.Sprintf("%d jobs active, %d queued", e.ActiveJobs, e.QueuedJobs))
+	}
+	for _, err := range e.Errs {
+		parts = append(parts, err.Error())
+	}
+	return "shutdown incomplete: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the underlying errors
+func (e *ShutdownError) Unwrap() []error {
+	return e.Errs
+}
+
+// Ready reports whether the engine is serving and not shutting down
+func (e *Engine) Ready() bool {
+	return e.ready.Load()
+}
+
+// Shutdown gracefully shuts down the engine in phases:
+//
+//  1. readiness starts failing so load balancers stop sending traffic
+//  2. the engine keeps serving for DrainPeriod
+//  3. listeners close and in-flight requests and pool jobs are awaited for
+//     up to ShutdownTimeout
+//  4. modules shut down in reverse initialization (dependency) order, so
+//     each stops before the modules it depends on, with their own
+//     ShutdownTimeout (30s when unset) even if ctx has already expired
+//
+// If time runs out, the returned *ShutdownError reports what was still
+// running. Shutdown is safe to call more than once; later calls wait for the
+// first one and return its result.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		e.shutdownErr = e.shutdownPhases(ctx)
+	})
+	return e.shutdownErr
+}
+
+// shutdownContext bounds a shutdown started by Run or Restart to the drain
+// period plus ShutdownTimeout, or defaultShutdownTimeout when that is unset
+func (e *Engine) shutdownContext() (context.Context, context.CancelFunc) {
+	timeout := e.config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	if e.config.GracefulShutdown {
+		timeout += e.config.DrainPeriod
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (e *Engine) shutdownPhases(ctx context.Context) error {
+	// Phase 1: fail readiness and signal shutdown
+	e.ready.Store(false)
+	close(e.shutdown)
+
+	// Phase 2: keep serving while traffic moves away
+	if e.config.GracefulShutdown && e.config.DrainPeriod > 0 && e.server != nil {
+		log.Printf("Draining for %v", e.config.DrainPeriod)
+		timer := time.NewTimer(e.config.DrainPeriod)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	// Phase 3: stop accepting and wait for in-flight work
+	waitCtx := ctx
+	if e.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, e.config.ShutdownTimeout)
+		defer cancel()
+	}
+
+	report := &ShutdownError{}
+
+	if e.server != nil {
+		var err error
+		if e.config.GracefulShutdown {
+			err = e.server.Shutdown(waitCtx)
+		} else {
+			err = e.server.Close()
+		}
+		if err != nil {
+			report.InFlightRequests = e.inFlight.Load()
+			report.Errs = append(report.Errs, fmt.Errorf("failed to shutdown HTTP server: %w", err))
+			// Force the remaining connections closed
+			e.server.Close()
+		}
+	}
+
+	if e.pool != nil {
+		if err := e.pool.Shutdown(waitCtx); err != nil {
+			stats := e.pool.Stats()
+			report.ActiveJobs = stats.ActiveJobs
+			report.QueuedJobs = stats.QueuedJobs
+			report.Errs = append(report.Errs, fmt.Errorf("failed to shutdown worker pool: %w", err))
+		}
+	}
+
+	// Phase 4: stop module run loops, then shut down modules, even if the
+	// wait above timed out, so they can release their resources
+	if e.cancelRun != nil {
+		e.cancelRun()
+	}
+	moduleTimeout := e.config.ShutdownTimeout
+	if moduleTimeout <= 0 {
+		moduleTimeout = defaultShutdownTimeout
+	}
+	moduleCtx, cancelModules := context.WithTimeout(context.WithoutCancel(ctx), moduleTimeout)
+	defer cancelModules()
+
+	if err := e.events.Drain(moduleCtx); err != nil {
+		report.Errs = append(report.Errs, fmt.Errorf("failed to drain event deliveries: %w", err))
+	}
+	if err := e.modules.ShutdownModules(moduleCtx); err != nil {
+		report.Errs = append(report.Errs, fmt.Errorf("failed to shutdown modules: %w", err))
+	}
+
+	// Wait for the serving goroutines to exit
+	e.wg.Wait()
+
+	if len(report.Errs) > 0 {
+		return report
+	}
+	return nil
+}
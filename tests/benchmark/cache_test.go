@@ -0,0 +1,63 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"neuron/pkg/cache"
+	"testing"
+	"time"
+)
+
+const cacheKeys = 10000
+
+// BenchmarkMemoryCache compares a single-shard cache, equivalent to one
+// global lock, with the default sharding under parallel load
+func BenchmarkMemoryCache(b *testing.B) {
+	keys := make([]string, cacheKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:%d", i)
+	}
+
+	workloads := []struct {
+		name     string
+		writePct int
+	}{
+		{"read-heavy", 10},
+		{"write-heavy", 50},
+	}
+
+	for _, shards := range []int{1, 0} {
+		for _, w := range workloads {
+			name := fmt.Sprintf("shards=%d/%s", shards, w.name)
+			if shards == 0 {
+				name = "shards=default/" + w.name
+			}
+			writePct := w.writePct
+
+			b.Run(name, func(b *testing.B) {
+				c := cache.NewMemoryCache(cache.Options{Shards: shards})
+				ctx := context.Background()
+				for i, key := range keys {
+					c.Set(ctx, key, i, time.Hour)
+				}
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					// Goroutines start at different keys so they don't
+					// move through the shards in lockstep
+					i := rand.Intn(cacheKeys)
+					for pb.Next() {
+						key := keys[i%cacheKeys]
+						if i%100 < writePct {
+							c.Set(ctx, key, i, time.Hour)
+						} else {
+							c.Get(ctx, key)
+						}
+						i += 7
+					}
+				})
+			})
+		}
+	}
+}